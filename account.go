@@ -0,0 +1,179 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/7minutech/chirpy/internal/auth"
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type Like struct {
+	ChirpID uuid.UUID `json:"chirp_id"`
+	LikedAt time.Time `json:"liked_at"`
+}
+
+// checkHasPassword responds and returns false when user has no password to
+// confirm an action with, such as a user who only logs in with an OIDC
+// provider, telling them how to set one.
+func checkHasPassword(w http.ResponseWriter, user database.User) bool {
+	if !user.HashedPassword.Valid {
+		msg := "account has no password, set a password first via /api/password/forgot"
+		respondWithError(w, http.StatusForbidden, msg, nil)
+		return false
+	}
+
+	return true
+}
+
+func (apiCfg *apiConfig) handlerDeleteAccount(w http.ResponseWriter, r *http.Request) {
+
+	defer r.Body.Close()
+
+	userID, err := apiCfg.authenticateSession(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	type parameters struct {
+		Password string `json:"password"`
+	}
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		msg := "could not decode request body"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	user, err := apiCfg.dbQueries.GetUser(r.Context(), userID)
+	if err != nil {
+		msg := "could not get user"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if !checkHasPassword(w, user) {
+		return
+	}
+
+	ok, err := auth.CheckPasswordHash(params.Password, user.HashedPassword.String)
+	if !ok || err != nil {
+		msg := "password is incorrect"
+		respondWithError(w, http.StatusForbidden, msg, err)
+		return
+	}
+
+	// chirps, likes, follows, refresh tokens and everything else the user
+	// owns are removed by ON DELETE CASCADE
+	if err := apiCfg.dbQueries.DeleteUser(r.Context(), user.ID); err != nil {
+		msg := "could not delete user"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusNoContent, nil)
+}
+
+func (apiCfg *apiConfig) handlerExportAccount(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := apiCfg.authenticateSession(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	user, err := apiCfg.dbQueries.GetUser(r.Context(), userID)
+	if err != nil {
+		msg := "could not get user"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	dbChirps, err := apiCfg.dbQueries.GetChirpsByAuthor(r.Context(), userID)
+	if err != nil {
+		msg := "could not get chirps"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	dbLikes, err := apiCfg.dbQueries.GetLikesByUser(r.Context(), userID)
+	if err != nil {
+		msg := "could not get likes"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	dbRefreshTokens, err := apiCfg.dbQueries.GetRefreshTokensByUser(r.Context(), userID)
+	if err != nil {
+		msg := "could not get sessions"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	dbTokens, err := apiCfg.dbQueries.GetPersonalAccessTokens(r.Context(), userID)
+	if err != nil {
+		msg := "could not get tokens"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	likes := make([]Like, len(dbLikes))
+	for i, dbLike := range dbLikes {
+		likes[i] = Like{ChirpID: dbLike.ChirpID, LikedAt: dbLike.CreatedAt}
+	}
+
+	sessions := make([]Session, len(dbRefreshTokens))
+	for i, dbRefreshToken := range dbRefreshTokens {
+		sessions[i] = convertSession(dbRefreshToken)
+	}
+
+	tokens := make([]PersonalAccessToken, len(dbTokens))
+	for i, dbToken := range dbTokens {
+		tokens[i] = convertPersonalAccessToken(dbToken)
+	}
+
+	files := []struct {
+		name    string
+		payload interface{}
+	}{
+		{name: "profile.json", payload: convertUser(user)},
+		{name: "chirps.json", payload: mapChirp(dbChirps)},
+		{name: "likes.json", payload: likes},
+		{name: "sessions.json", payload: sessions},
+		{name: "tokens.json", payload: tokens},
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="chirpy-export.zip"`)
+	w.WriteHeader(http.StatusOK)
+
+	// the status is already sent, so errors from here on can only be logged
+	archive := zip.NewWriter(w)
+
+	for _, file := range files {
+		fileWriter, err := archive.Create(file.name)
+		if err != nil {
+			log.Printf("Error creating %s in export: %s", file.name, err)
+			return
+		}
+
+		encoder := json.NewEncoder(fileWriter)
+		encoder.SetIndent("", "  ")
+
+		if err := encoder.Encode(file.payload); err != nil {
+			log.Printf("Error writing %s in export: %s", file.name, err)
+			return
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		log.Printf("Error finishing export: %s", err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/7minutech/chirpy/internal/auth"
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/7minutech/chirpy/internal/lockout"
+	"github.com/google/uuid"
+)
+
+func TestPasswordlessUserIsToldToSetPassword(t *testing.T) {
+	userID := uuid.New()
+
+	fake, db := newFakeDB(t)
+
+	// a user who only ever logged in with an OIDC provider
+	fake.answer("GetUser", func(args []driver.Value) ([]map[string]any, error) {
+		return []map[string]any{{"id": userID, "email": "skyler@example.com", "hashed_password": nil}}, nil
+	})
+
+	keys := auth.NewKeyring()
+	keys.AddHMACKey("secret")
+
+	tok, err := auth.MakeJWT(userID, keys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT err = %v", err)
+	}
+
+	store := lockout.NewMemoryStore()
+
+	apiCfg := &apiConfig{
+		db:             db,
+		dbQueries:      database.New(db),
+		jwtKeys:        keys,
+		accountLimiter: lockout.New(store, accountLoginPolicy),
+		ipLimiter:      lockout.New(store, ipLoginPolicy),
+	}
+
+	cases := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+	}{
+		{name: "delete account", handler: apiCfg.handlerDeleteAccount, body: `{"password": ""}`},
+		{name: "disable 2fa", handler: apiCfg.handlerDisableTOTP, body: `{"password": ""}`},
+		{name: "change email", handler: apiCfg.handlerUpdateUser, body: `{"email": "new@example.com", "current_password": ""}`},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(c.body))
+		r.Header.Set("Authorization", "Bearer "+tok)
+		w := httptest.NewRecorder()
+
+		c.handler(w, r)
+
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "set a password first") {
+			t.Errorf("%s: response = %d %s, expected 403 telling the user to set a password", c.name, w.Code, w.Body.String())
+		}
+	}
+
+	if calls := fake.callsTo("DeleteUser"); len(calls) != 0 {
+		t.Errorf("user was deleted without a password")
+	}
+}
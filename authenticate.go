@@ -0,0 +1,133 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/7minutech/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+// Scopes limit what a personal access token or an OAuth client can do.
+// Access tokens from logging in can do everything.
+const (
+	scopeChirpsRead   = "chirps:read"
+	scopeChirpsWrite  = "chirps:write"
+	scopeProfileWrite = "profile:write"
+	scopeFollowsWrite = "follows:write"
+)
+
+var allScopes = []string{scopeChirpsRead, scopeChirpsWrite, scopeProfileWrite, scopeFollowsWrite}
+
+var (
+	errMissingToken      = errors.New("token was not given in headers")
+	errInvalidToken      = errors.New("token was not valid")
+	errInsufficientScope = errors.New("token does not have the required scope")
+	errSessionRequired   = errors.New("this action needs a login session, not a personal access token or app")
+)
+
+// authenticate returns the user the request is made for. It accepts a JWT
+// access token, or a personal access token or OAuth access token that has
+// scope.
+func (apiCfg *apiConfig) authenticate(r *http.Request, scope string) (uuid.UUID, error) {
+	return apiCfg.authenticateToken(r, scope, true)
+}
+
+// authenticateToken is authenticate, but only records that a personal access
+// token was used when touch is set.
+func (apiCfg *apiConfig) authenticateToken(r *http.Request, scope string, touch bool) (uuid.UUID, error) {
+	tok, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.UUID{}, errMissingToken
+	}
+
+	if !auth.IsPersonalAccessToken(tok) {
+		claims, err := auth.ParseAccessToken(tok, apiCfg.jwtKeys)
+		if err != nil {
+			return uuid.UUID{}, errInvalidToken
+		}
+
+		if !claims.IsOAuth() {
+			return claims.UserID, nil
+		}
+
+		if !slices.Contains(claims.Scopes, scope) {
+			return uuid.UUID{}, errInsufficientScope
+		}
+
+		// OAuth access tokens stop working as soon as their grant is revoked,
+		// not just when they expire
+		_, err = apiCfg.dbQueries.GetOAuthGrant(r.Context(), claims.GrantID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return uuid.UUID{}, errInvalidToken
+		}
+
+		if err != nil {
+			return uuid.UUID{}, fmt.Errorf("could not get oauth grant: %w", err)
+		}
+
+		return claims.UserID, nil
+	}
+
+	pat, err := apiCfg.dbQueries.GetPersonalAccessToken(r.Context(), auth.HashToken(tok))
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.UUID{}, errInvalidToken
+	}
+
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("could not get personal access token: %w", err)
+	}
+
+	if !slices.Contains(pat.Scopes, scope) {
+		return uuid.UUID{}, errInsufficientScope
+	}
+
+	if !touch {
+		return pat.UserID, nil
+	}
+
+	if err := apiCfg.dbQueries.TouchPersonalAccessToken(r.Context(), pat.ID); err != nil {
+		return uuid.UUID{}, fmt.Errorf("could not update personal access token: %w", err)
+	}
+
+	return pat.UserID, nil
+}
+
+// authenticateSession is authenticate for account management, which personal
+// access tokens and OAuth clients are never allowed to do.
+func (apiCfg *apiConfig) authenticateSession(r *http.Request) (uuid.UUID, error) {
+	tok, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.UUID{}, errMissingToken
+	}
+
+	if auth.IsPersonalAccessToken(tok) {
+		return uuid.UUID{}, errSessionRequired
+	}
+
+	claims, err := auth.ParseAccessToken(tok, apiCfg.jwtKeys)
+	if err != nil {
+		return uuid.UUID{}, errInvalidToken
+	}
+
+	if claims.IsOAuth() {
+		return uuid.UUID{}, errSessionRequired
+	}
+
+	return claims.UserID, nil
+}
+
+func respondWithAuthError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errMissingToken), errors.Is(err, errInvalidToken):
+		respondWithError(w, http.StatusUnauthorized, err.Error(), err)
+	case errors.Is(err, errInsufficientScope), errors.Is(err, errSessionRequired):
+		respondWithError(w, http.StatusForbidden, err.Error(), err)
+	default:
+		msg := "could not check token"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+	}
+}
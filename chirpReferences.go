@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const (
+	chirpKindChirp       = "chirp"
+	chirpKindRechirp     = "rechirp"
+	chirpKindQuote       = "quote"
+	chirpKindUnavailable = "unavailable"
+)
+
+// unavailableChirp stands in for the chirp a quote points at once that chirp
+// has been deleted.
+var unavailableChirp = Chirp{
+	Kind: chirpKindUnavailable,
+	Body: "chirp unavailable",
+}
+
+func (apiCfg *apiConfig) addReferencedChirps(ctx context.Context, chirps []Chirp) error {
+	var ids []uuid.UUID
+	for _, chirp := range chirps {
+		if chirp.RechirpOf.Valid {
+			ids = append(ids, chirp.RechirpOf.UUID)
+		}
+		if chirp.QuoteOf.Valid {
+			ids = append(ids, chirp.QuoteOf.UUID)
+		}
+	}
+
+	referenced := make(map[uuid.UUID]Chirp, len(ids))
+
+	if len(ids) > 0 {
+		dbChirps, err := apiCfg.dbQueries.GetChirpsByIDs(ctx, ids)
+		if err != nil {
+			return err
+		}
+
+		for _, dbChirp := range dbChirps {
+			referenced[dbChirp.ID] = convertChirp(dbChirp)
+		}
+	}
+
+	attachReferencedChirps(chirps, referenced)
+
+	return nil
+}
+
+// attachReferencedChirps embeds the chirp each rechirp or quote points at.
+// Quotes whose chirp is gone get the unavailable placeholder instead.
+func attachReferencedChirps(chirps []Chirp, referenced map[uuid.UUID]Chirp) {
+	for i := range chirps {
+		var ref Chirp
+		var ok bool
+
+		switch chirps[i].Kind {
+		case chirpKindRechirp:
+			ref, ok = referenced[chirps[i].RechirpOf.UUID]
+		case chirpKindQuote:
+			ref, ok = referenced[chirps[i].QuoteOf.UUID]
+			if !ok {
+				ref, ok = unavailableChirp, true
+			}
+		}
+
+		if ok {
+			chirps[i].ReferencedChirp = &ref
+		}
+	}
+}
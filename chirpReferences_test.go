@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestAttachReferencedChirps(t *testing.T) {
+	original := Chirp{ID: uuid.New(), Kind: chirpKindChirp, Body: "original"}
+	rechirp := Chirp{ID: uuid.New(), Kind: chirpKindRechirp, RechirpOf: uuid.NullUUID{UUID: original.ID, Valid: true}}
+	quote := Chirp{ID: uuid.New(), Kind: chirpKindQuote, Body: "so true", QuoteOf: uuid.NullUUID{UUID: original.ID, Valid: true}}
+	deletedQuote := Chirp{ID: uuid.New(), Kind: chirpKindQuote, Body: "was so true"}
+
+	chirps := []Chirp{original, rechirp, quote, deletedQuote}
+	referenced := map[uuid.UUID]Chirp{original.ID: original}
+
+	attachReferencedChirps(chirps, referenced)
+
+	if chirps[0].ReferencedChirp != nil {
+		t.Errorf("chirps[0].ReferencedChirp == %v, expected: nil", chirps[0].ReferencedChirp)
+	}
+
+	cases := []struct {
+		actual   *Chirp
+		expected Chirp
+	}{
+		{actual: chirps[1].ReferencedChirp, expected: original},
+		{actual: chirps[2].ReferencedChirp, expected: original},
+		{actual: chirps[3].ReferencedChirp, expected: unavailableChirp},
+	}
+
+	for i, c := range cases {
+		if c.actual == nil {
+			t.Errorf("cases[%d].actual == nil, expected: %v", i, c.expected)
+			continue
+		}
+
+		if *c.actual != c.expected {
+			t.Errorf("cases[%d].actual == %v, expected: %v", i, *c.actual, c.expected)
+		}
+	}
+}
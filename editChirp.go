@@ -0,0 +1,205 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type ChirpRevision struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	Body      string    `json:"body"`
+}
+
+func (apiCfg *apiConfig) handlerUpdateChirp(w http.ResponseWriter, r *http.Request) {
+
+	defer r.Body.Close()
+
+	userID, err := apiCfg.authenticate(r, scopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		msg := "could not parse chirp id"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	type parameters struct {
+		Body string `json:"body"`
+	}
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		msg := "could not decode request body"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	if len(params.Body) > maxChirpLength {
+		respondWithError(w, http.StatusBadRequest, "Chirp is too long", nil)
+		return
+	}
+
+	// editing publishes text just like posting does
+	author, err := apiCfg.dbQueries.GetUser(r.Context(), userID)
+	if err != nil {
+		msg := "could not get user"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if !author.EmailVerifiedAt.Valid {
+		msg := "email must be verified before posting"
+		respondWithError(w, http.StatusForbidden, msg, nil)
+		return
+	}
+
+	tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		msg := "could not start transaction"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := apiCfg.dbQueries.WithTx(tx)
+
+	// the row stays locked until the commit, so a concurrent edit waits and
+	// then saves this edit's body as its revision instead of losing it
+	dbChirp, err := qtx.GetChirpForUpdate(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := "could not get chirp"
+		respondWithError(w, http.StatusNotFound, msg, err)
+		return
+	}
+
+	if err != nil {
+		msg := "could not get chirp"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if dbChirp.UserID != userID {
+		msg := "user is not creator of chirp"
+		respondWithError(w, http.StatusForbidden, msg, nil)
+		return
+	}
+
+	if dbChirp.Kind == chirpKindRechirp {
+		msg := "rechirp can not be edited"
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	if dbChirp.Kind == chirpKindQuote && strings.TrimSpace(params.Body) == "" {
+		msg := "quote must have a body"
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	revisionParams := database.CreateChirpRevisionParams{
+		ChirpID: dbChirp.ID,
+		Body:    dbChirp.Body,
+	}
+
+	if _, err := qtx.CreateChirpRevision(r.Context(), revisionParams); err != nil {
+		msg := "could not save chirp revision"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	updateParams := database.UpdateChirpBodyParams{
+		Body: cleanProfanity(params.Body),
+		ID:   dbChirp.ID,
+	}
+
+	updatedChirp, err := qtx.UpdateChirpBody(r.Context(), updateParams)
+	if err != nil {
+		msg := "could not update chirp"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if err := saveChirpHashtags(r.Context(), qtx, updatedChirp); err != nil {
+		msg := "could not save chirp hashtags"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if err := saveChirpMentions(r.Context(), qtx, updatedChirp); err != nil {
+		msg := "could not save chirp mentions"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		msg := "could not update chirp"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	chirps := mapChirp([]database.Chirp{updatedChirp})
+
+	if err := apiCfg.populateChirps(r.Context(), chirps, uuid.NullUUID{UUID: userID, Valid: true}); err != nil {
+		msg := "could not get chirp details"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chirps[0])
+}
+
+func (apiCfg *apiConfig) handlerGetChirpRevisions(w http.ResponseWriter, r *http.Request) {
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		msg := "could not parse chirpID from string to uuid"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	_, err = apiCfg.dbQueries.GetChirp(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := "chirp does not exist"
+		respondWithError(w, http.StatusNotFound, msg, err)
+		return
+	}
+
+	if err != nil {
+		msg := "db error getting chrip"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	dbRevisions, err := apiCfg.dbQueries.GetChirpRevisions(r.Context(), chirpID)
+	if err != nil {
+		msg := "could not get chirp revisions"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	revisions := make([]ChirpRevision, len(dbRevisions))
+	for i, dbRevision := range dbRevisions {
+		revisions[i] = ChirpRevision{
+			ID:        dbRevision.ID,
+			CreatedAt: dbRevision.CreatedAt,
+			ChirpID:   dbRevision.ChirpID,
+			Body:      dbRevision.Body,
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, revisions)
+}
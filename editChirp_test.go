@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/7minutech/chirpy/internal/auth"
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestUpdateChirpRefusals(t *testing.T) {
+	userID, otherID, chirpID := uuid.New(), uuid.New(), uuid.New()
+
+	cases := []struct {
+		name      string
+		verified  bool
+		chirpUser uuid.UUID
+		expected  int
+	}{
+		{name: "unverified email", verified: false, chirpUser: userID, expected: http.StatusForbidden},
+		{name: "someone else's chirp", verified: true, chirpUser: otherID, expected: http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		fake, db := newFakeDB(t)
+
+		fake.answer("GetUser", func(args []driver.Value) ([]map[string]any, error) {
+			user := map[string]any{"id": userID}
+			if c.verified {
+				user["email_verified_at"] = time.Now()
+			}
+			return []map[string]any{user}, nil
+		})
+
+		fake.answer("GetChirpForUpdate", func(args []driver.Value) ([]map[string]any, error) {
+			return []map[string]any{{
+				"id":         chirpID,
+				"created_at": time.Time{},
+				"updated_at": time.Time{},
+				"body":       "before",
+				"user_id":    c.chirpUser,
+				"kind":       chirpKindChirp,
+			}}, nil
+		})
+
+		keys := auth.NewKeyring()
+		keys.AddHMACKey("secret")
+
+		tok, err := auth.MakeJWT(userID, keys, time.Hour)
+		if err != nil {
+			t.Fatalf("MakeJWT err = %v", err)
+		}
+
+		apiCfg := &apiConfig{db: db, dbQueries: database.New(db), jwtKeys: keys}
+
+		r := httptest.NewRequest(http.MethodPut, "/api/chirps/"+chirpID.String(), strings.NewReader(`{"body": "after"}`))
+		r.SetPathValue("chirpID", chirpID.String())
+		r.Header.Set("Authorization", "Bearer "+tok)
+		w := httptest.NewRecorder()
+
+		apiCfg.handlerUpdateChirp(w, r)
+
+		if w.Code != c.expected {
+			t.Errorf("%s: status = %d, expected %d", c.name, w.Code, c.expected)
+		}
+
+		if calls := fake.callsTo("UpdateChirpBody"); len(calls) != 0 {
+			t.Errorf("%s: chirp was updated %d times, expected none", c.name, len(calls))
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDB is a database/sql driver for testing handlers without Postgres.
+// Statements are told apart by the "-- name: X" line sqlc starts each query
+// with. Every statement is recorded, and answer sets the rows one returns;
+// statements without an answer affect and return no rows.
+type fakeDB struct {
+	mu      sync.Mutex
+	answers map[string]fakeAnswer
+	calls   []fakeCall
+}
+
+// fakeAnswer returns the rows for a statement run with args, as column name
+// to value. Columns left out get fakeColumnDefaults, or NULL.
+type fakeAnswer func(args []driver.Value) ([]map[string]any, error)
+
+type fakeCall struct {
+	name string
+	args []driver.Value
+}
+
+// fakeColumnDefaults fills NOT NULL columns a test doesn't care about.
+var fakeColumnDefaults = map[string]any{
+	"created_at":     time.Time{},
+	"updated_at":     time.Time{},
+	"email":          "",
+	"is_chirpy_red":  false,
+	"display_name":   "",
+	"bio":            "",
+	"location":       "",
+	"totp_last_step": int64(0),
+}
+
+var queryNamePattern = regexp.MustCompile(`-- name: (\w+)`)
+
+func newFakeDB(t *testing.T) (*fakeDB, *sql.DB) {
+	fake := &fakeDB{answers: make(map[string]fakeAnswer)}
+
+	db := sql.OpenDB(fake)
+	t.Cleanup(func() { db.Close() })
+
+	return fake, db
+}
+
+func (f *fakeDB) answer(name string, answer fakeAnswer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.answers[name] = answer
+}
+
+// callsTo returns the arguments of every run of the statement name.
+func (f *fakeDB) callsTo(name string) [][]driver.Value {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var calls [][]driver.Value
+	for _, call := range f.calls {
+		if call.name == name {
+			calls = append(calls, call.args)
+		}
+	}
+
+	return calls
+}
+
+func (f *fakeDB) run(query string, args []driver.Value) ([]map[string]any, error) {
+	name := ""
+	if match := queryNamePattern.FindStringSubmatch(query); match != nil {
+		name = match[1]
+	}
+
+	f.mu.Lock()
+	f.calls = append(f.calls, fakeCall{name: name, args: args})
+	answer := f.answers[name]
+	f.mu.Unlock()
+
+	if answer == nil {
+		return nil, nil
+	}
+
+	return answer(args)
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) {
+	return fakeConn{db: f}, nil
+}
+
+func (f *fakeDB) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("fakedb: open it with sql.OpenDB")
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{db: c.db, query: query}, nil
+}
+
+func (c fakeConn) Close() error { return nil }
+
+func (c fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error { return nil }
+
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s fakeStmt) Close() error { return nil }
+
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	rows, err := s.db.run(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(len(rows)), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, err := s.db.run(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fakeRows{columns: queryColumns(s.query), rows: rows}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    []map[string]any
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	row := r.rows[0]
+	r.rows = r.rows[1:]
+
+	for i, column := range r.columns {
+		value, ok := row[column]
+		if !ok {
+			value = fakeColumnDefaults[column]
+		}
+
+		if valuer, ok := value.(driver.Valuer); ok {
+			v, err := valuer.Value()
+			if err != nil {
+				return err
+			}
+			value = v
+		}
+
+		dest[i] = value
+	}
+
+	return nil
+}
+
+// queryColumns returns the names of the columns query returns, from its
+// RETURNING clause or its select list.
+func queryColumns(query string) []string {
+	var list string
+
+	if i := strings.LastIndex(query, "RETURNING "); i >= 0 {
+		list = query[i+len("RETURNING "):]
+	} else if i := strings.Index(query, "SELECT "); i >= 0 {
+		list = query[i+len("SELECT "):]
+		if end := topLevelIndex(list, " FROM "); end >= 0 {
+			list = list[:end]
+		}
+	} else {
+		return nil
+	}
+
+	var columns []string
+	depth, start := 0, 0
+	for i, c := range list + "," {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				columns = append(columns, columnName(list[start:min(i, len(list))]))
+				start = i + 1
+			}
+		}
+	}
+
+	return columns
+}
+
+// topLevelIndex is strings.Index, skipping matches inside parentheses.
+func topLevelIndex(s, substr string) int {
+	depth := 0
+	for i := range s {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+
+		if depth == 0 && strings.HasPrefix(s[i:], substr) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func columnName(expr string) string {
+	fields := strings.Fields(expr)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	name := fields[len(fields)-1]
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+
+	return strings.Trim(name, `";`)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type Follow struct {
+	UserID     uuid.UUID `json:"user_id"`
+	Handle     string    `json:"handle"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+func (apiCfg *apiConfig) handlerFollow(w http.ResponseWriter, r *http.Request) {
+
+	defer r.Body.Close()
+
+	followerID, err := apiCfg.authenticate(r, scopeFollowsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		msg := "could not parse user id"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	if followeeID == followerID {
+		msg := "user can not follow themselves"
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	_, err = apiCfg.dbQueries.GetUser(r.Context(), followeeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := "user does not exist"
+		respondWithError(w, http.StatusNotFound, msg, err)
+		return
+	}
+
+	if err != nil {
+		msg := "could not get user"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	followParams := database.FollowUserParams{
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+	}
+
+	if err := apiCfg.dbQueries.FollowUser(r.Context(), followParams); err != nil {
+		msg := "could not follow user"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusNoContent, nil)
+}
+
+func (apiCfg *apiConfig) handlerUnfollow(w http.ResponseWriter, r *http.Request) {
+
+	defer r.Body.Close()
+
+	followerID, err := apiCfg.authenticate(r, scopeFollowsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		msg := "could not parse user id"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	unfollowParams := database.UnfollowUserParams{
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+	}
+
+	if err := apiCfg.dbQueries.UnfollowUser(r.Context(), unfollowParams); err != nil {
+		msg := "could not unfollow user"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusNoContent, nil)
+}
+
+func (apiCfg *apiConfig) handlerGetFollowers(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		msg := "could not parse user id"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	dbFollowers, err := apiCfg.dbQueries.GetFollowers(r.Context(), userID)
+	if err != nil {
+		msg := "could not get followers"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	followers := make([]Follow, len(dbFollowers))
+	for i, dbFollower := range dbFollowers {
+		followers[i] = Follow{
+			UserID:     dbFollower.FollowerID,
+			Handle:     dbFollower.Handle.String,
+			FollowedAt: dbFollower.CreatedAt,
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, followers)
+}
+
+func (apiCfg *apiConfig) handlerGetFollowing(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		msg := "could not parse user id"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	dbFollowing, err := apiCfg.dbQueries.GetFollowing(r.Context(), userID)
+	if err != nil {
+		msg := "could not get followed users"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	following := make([]Follow, len(dbFollowing))
+	for i, dbFollow := range dbFollowing {
+		following[i] = Follow{
+			UserID:     dbFollow.FolloweeID,
+			Handle:     dbFollow.Handle.String,
+			FollowedAt: dbFollow.CreatedAt,
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, following)
+}
+
+func (apiCfg *apiConfig) handlerTimeline(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := apiCfg.authenticate(r, scopeChirpsRead)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	dbChirps, err := apiCfg.dbQueries.GetTimeline(r.Context(), userID)
+	if err != nil {
+		msg := "could not get timeline"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	chirps := mapChirp(dbChirps)
+
+	if err := apiCfg.populateChirps(r.Context(), chirps, uuid.NullUUID{UUID: userID, Valid: true}); err != nil {
+		msg := "could not get chirp details"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chirps)
+}
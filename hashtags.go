@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/7minutech/chirpy/internal/database"
+)
+
+const (
+	defaultTrendingWindow = 24 * time.Hour
+	maxTrendingWindow     = 7 * 24 * time.Hour
+	trendingHashtagsLimit = 10
+)
+
+// a hashtag has to start the body or follow a character that can't be part
+// of a tag, so "C#" or "a#b" are not tags
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_#])#([\p{L}\p{N}_]+)`)
+
+type TrendingHashtag struct {
+	Name         string    `json:"name"`
+	Uses         int64     `json:"uses"`
+	PreviousUses int64     `json:"previous_uses"`
+	Velocity     float64   `json:"velocity"`
+	LastUsedAt   time.Time `json:"last_used_at"`
+}
+
+// extractHashtags returns the distinct lowercased hashtags in body, without
+// the leading '#', in the order they first appear.
+func extractHashtags(body string) []string {
+	seen := make(map[string]struct{})
+	var tags []string
+
+	for _, match := range hashtagPattern.FindAllStringSubmatch(body, -1) {
+		tag := strings.ToLower(match[1])
+		if _, ok := seen[tag]; ok {
+			continue
+		}
+		seen[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+// saveChirpHashtags replaces the hashtags linked to chirp with the ones in
+// its body. Pass queries bound to the transaction that stored the chirp.
+func saveChirpHashtags(ctx context.Context, queries *database.Queries, chirp database.Chirp) error {
+	if err := queries.DeleteChirpHashtags(ctx, chirp.ID); err != nil {
+		return err
+	}
+
+	for _, tag := range extractHashtags(chirp.Body) {
+		hashtag, err := queries.UpsertHashtag(ctx, tag)
+		if err != nil {
+			return err
+		}
+
+		chirpHashtagParams := database.AddChirpHashtagParams{
+			ChirpID:   chirp.ID,
+			HashtagID: hashtag.ID,
+			// dated by the chirp, so editing it doesn't make its tags trend
+			// again
+			CreatedAt: chirp.CreatedAt,
+		}
+
+		if err := queries.AddChirpHashtag(ctx, chirpHashtagParams); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (apiCfg *apiConfig) handlerGetHashtagChirps(w http.ResponseWriter, r *http.Request) {
+
+	tag := strings.ToLower(strings.TrimPrefix(r.PathValue("tag"), "#"))
+	if tag == "" {
+		msg := "hashtag was not given"
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	hashtagParams := database.GetChirpsByHashtagParams{
+		Name:     tag,
+		RowLimit: defaultChirpPageSize,
+	}
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxChirpPageSize {
+			msg := fmt.Sprintf("limit must be between 1 and %d", maxChirpPageSize)
+			respondWithError(w, http.StatusBadRequest, msg, err)
+			return
+		}
+
+		hashtagParams.RowLimit = int32(limit)
+	}
+
+	dbChirps, err := apiCfg.dbQueries.GetChirpsByHashtag(r.Context(), hashtagParams)
+	if err != nil {
+		msg := "could not get chirps for hashtag"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	chirps := mapChirp(dbChirps)
+
+	if err := apiCfg.populateChirps(r.Context(), chirps, apiCfg.viewerID(r)); err != nil {
+		msg := "could not get chirp details"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chirps)
+}
+
+func (apiCfg *apiConfig) handlerGetTrendingHashtags(w http.ResponseWriter, r *http.Request) {
+
+	window := defaultTrendingWindow
+
+	if windowStr := r.URL.Query().Get("window"); windowStr != "" {
+
+		parsedWindow, err := time.ParseDuration(windowStr)
+		if err != nil || parsedWindow < time.Minute || parsedWindow > maxTrendingWindow {
+			msg := fmt.Sprintf("window must be a duration between 1m and %s", maxTrendingWindow)
+			respondWithError(w, http.StatusBadRequest, msg, err)
+			return
+		}
+
+		window = parsedWindow
+	}
+
+	// tags are ranked by how much their use grew compared with the window
+	// before, so steadily popular tags don't crowd out rising ones
+	since := time.Now().UTC().Add(-window)
+
+	trendingParams := database.GetTrendingHashtagsParams{
+		Since:         since,
+		PreviousSince: since.Add(-window),
+		RowLimit:      trendingHashtagsLimit,
+	}
+
+	rows, err := apiCfg.dbQueries.GetTrendingHashtags(r.Context(), trendingParams)
+	if err != nil {
+		msg := "could not get trending hashtags"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	hashtags := make([]TrendingHashtag, len(rows))
+	for i, row := range rows {
+		hashtags[i] = TrendingHashtag{
+			Name:         row.Name,
+			Uses:         row.Uses,
+			PreviousUses: row.PreviousUses,
+			Velocity:     float64(row.Uses-row.PreviousUses) / window.Hours(),
+			LastUsedAt:   row.LastUsedAt,
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, hashtags)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			input:    "I had something interesting for breakfast",
+			expected: nil,
+		},
+		{
+			input:    "#breakfast was #Great",
+			expected: []string{"breakfast", "great"},
+		},
+		{
+			input:    "#go #Go #GO and #golang_2025!",
+			expected: []string{"go", "golang_2025"},
+		},
+		{
+			input:    "C# is not a tag and neither is a#b or ##double",
+			expected: nil,
+		},
+		{
+			input:    "(#café) #日本",
+			expected: []string{"café", "日本"},
+		},
+	}
+
+	for _, c := range cases {
+		actual := extractHashtags(c.input)
+		if !slices.Equal(actual, c.expected) {
+			t.Errorf("extractHashtags(%s) == %v, expected: %v", c.input, actual, c.expected)
+		}
+	}
+}
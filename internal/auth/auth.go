@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -16,8 +17,30 @@ import (
 
 const tokenStart = "Bearer "
 
-func HashPassword(password string) (string, error) {
-	hashedPass, err := argon2id.CreateHash(password, argon2id.DefaultParams)
+// personalAccessTokenPrefix tells personal access tokens apart from JWTs,
+// and makes leaked ones easy for secret scanners to spot.
+const personalAccessTokenPrefix = "chirpy_pat_"
+
+// ErrPasswordNotSet is returned for an empty hash, which users without a
+// password have: those created before passwords existed, and those who signed
+// up through an OpenID Connect provider. They have to reset their password
+// before they can log in with one.
+var ErrPasswordNotSet = errors.New("password has not been set")
+
+// PasswordParams are the argon2id settings new password hashes are made
+// with. Hashes record their own settings, so changing these doesn't break
+// existing ones.
+type PasswordParams = argon2id.Params
+
+// DefaultPasswordParams returns a copy of the library defaults, safe for the
+// caller to change.
+func DefaultPasswordParams() *PasswordParams {
+	params := *argon2id.DefaultParams
+	return &params
+}
+
+func HashPassword(password string, params *PasswordParams) (string, error) {
+	hashedPass, err := argon2id.CreateHash(password, params)
 	if err != nil {
 		return "", err
 	}
@@ -26,46 +49,108 @@ func HashPassword(password string) (string, error) {
 }
 
 func CheckPasswordHash(password, hash string) (bool, error) {
+	if hash == "" {
+		return false, ErrPasswordNotSet
+	}
+
 	return argon2id.ComparePasswordAndHash(password, hash)
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	claims := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  &jwt.NumericDate{Time: time.Now().UTC()},
-		ExpiresAt: &jwt.NumericDate{Time: time.Now().UTC().Add(expiresIn)},
-		Subject:   userID.String(),
+// NeedsRehash reports whether hash was made with settings other than params,
+// so it should be replaced the next time the password is known.
+func NeedsRehash(hash string, params *PasswordParams) bool {
+	hashParams, _, _, err := argon2id.DecodeHash(hash)
+	if err != nil {
+		return false
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return *hashParams != *params
+}
+
+// mfaAudience marks tokens that only prove the password was right. They can
+// be exchanged for access tokens with a second factor, and nothing else.
+const mfaAudience = "chirpy-mfa"
+
+// MakeJWT signs an access token for userID with the keyring's signing key.
+func MakeJWT(userID uuid.UUID, keys *Keyring, expiresIn time.Duration) (string, error) {
+	return makeToken(userID, keys, expiresIn, tokenClaims{})
+}
 
-	str, err := token.SignedString([]byte(tokenSecret))
+// ValidateJWT accepts an access token signed by any key in the keyring.
+func ValidateJWT(tokenString string, keys *Keyring) (uuid.UUID, error) {
+	claims, err := parseToken(tokenString, keys)
 	if err != nil {
-		return "", err
+		return uuid.UUID{}, err
 	}
 
-	return str, err
+	// access tokens have no audience, anything else is meant for a
+	// different purpose
+	if len(claims.Audience) != 0 {
+		return uuid.UUID{}, fmt.Errorf("invalid token")
+	}
+
+	return uuid.Parse(claims.Subject)
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := &jwt.RegisteredClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+// MakeMFAToken signs a token saying userID passed the first login step.
+func MakeMFAToken(userID uuid.UUID, keys *Keyring, expiresIn time.Duration) (string, error) {
+	claims := tokenClaims{}
+	claims.Audience = jwt.ClaimStrings{mfaAudience}
 
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method")
-		}
-		return []byte(tokenSecret), nil
-	})
-	if err != nil || !token.Valid {
+	return makeToken(userID, keys, expiresIn, claims)
+}
+
+func ValidateMFAToken(tokenString string, keys *Keyring) (uuid.UUID, error) {
+	claims, err := parseToken(tokenString, keys)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+
+	if !claims.VerifyAudience(mfaAudience, true) {
 		return uuid.UUID{}, fmt.Errorf("invalid token")
 	}
 
-	id, err := uuid.Parse(claims.Subject)
+	return uuid.Parse(claims.Subject)
+}
+
+// tokenClaims are the claims of every token signed here. The OAuth claims
+// are only set on access tokens issued to third-party clients.
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	GrantID  string `json:"grant_id,omitempty"`
+}
+
+// makeToken signs claims for userID, filling in the registered claims other
+// than the audience.
+func makeToken(userID uuid.UUID, keys *Keyring, expiresIn time.Duration, claims tokenClaims) (string, error) {
+	sk, err := keys.signingKey()
 	if err != nil {
-		return uuid.UUID{}, err
+		return "", err
+	}
+
+	claims.Issuer = "chirpy"
+	claims.IssuedAt = &jwt.NumericDate{Time: time.Now().UTC()}
+	claims.ExpiresAt = &jwt.NumericDate{Time: time.Now().UTC().Add(expiresIn)}
+	claims.Subject = userID.String()
+
+	token := jwt.NewWithClaims(sk.method, claims)
+	if sk.id != "" {
+		token.Header["kid"] = sk.id
+	}
+
+	return token.SignedString(sk.signing)
+}
+
+func parseToken(tokenString string, keys *Keyring) (*tokenClaims, error) {
+	claims := &tokenClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, keys.keyFunc)
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("invalid token")
 	}
-	return id, nil
 
+	return claims, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -97,6 +182,26 @@ func MakeRefreshToken() (string, error) {
 	return tok, nil
 }
 
+func MakePersonalAccessToken() (string, error) {
+	tok, err := MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	return personalAccessTokenPrefix + tok, nil
+}
+
+func IsPersonalAccessToken(tok string) bool {
+	return strings.HasPrefix(tok, personalAccessTokenPrefix)
+}
+
+// HashToken returns the hex SHA-256 of a random token, for tokens that are
+// looked up by value but shouldn't be stored in the clear.
+func HashToken(tok string) string {
+	sum := sha256.Sum256([]byte(tok))
+	return hex.EncodeToString(sum[:])
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	apikey := headers.Get("Authorization")
 
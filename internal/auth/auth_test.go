@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,18 +13,18 @@ import (
 func TestCheckPasswordHash(t *testing.T) {
 
 	password1 := "password123"
-	hash1, err := HashPassword(password1)
+	hash1, err := HashPassword(password1, DefaultPasswordParams())
 	if err != nil {
 		t.Errorf("HashPassword(%s) err was not nil", password1)
 	}
 
 	password2 := "seasame456"
-	hash2False, err := HashPassword(password1)
+	hash2False, err := HashPassword(password1, DefaultPasswordParams())
 	if err != nil {
 		t.Errorf("HashPassword(%s) err was not nil", password1)
 	}
 
-	hash2True, err := HashPassword(password2)
+	hash2True, err := HashPassword(password2, DefaultPasswordParams())
 	if err != nil {
 		t.Errorf("HashPassword(%s) err was not nil", password2)
 	}
@@ -70,15 +72,50 @@ func TestCheckPasswordHash(t *testing.T) {
 	}
 }
 
+func TestCheckPasswordHashUnset(t *testing.T) {
+	ok, err := CheckPasswordHash("", "")
+	if ok || !errors.Is(err, ErrPasswordNotSet) {
+		t.Fatalf("CheckPasswordHash on empty hash = %t, %v, expected ErrPasswordNotSet", ok, err)
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	oldParams := DefaultPasswordParams()
+	hash, err := HashPassword("password123", oldParams)
+	if err != nil {
+		t.Fatalf("HashPassword err = %v", err)
+	}
+
+	if NeedsRehash(hash, oldParams) {
+		t.Fatalf("expected hash made with current params not to need a rehash")
+	}
+
+	newParams := DefaultPasswordParams()
+	newParams.Iterations++
+	if !NeedsRehash(hash, newParams) {
+		t.Fatalf("expected hash made with old params to need a rehash")
+	}
+
+	if NeedsRehash("", newParams) {
+		t.Fatalf("expected empty hash not to need a rehash")
+	}
+}
+
+func hmacKeyring(secret string) *Keyring {
+	keys := NewKeyring()
+	keys.AddHMACKey(secret)
+	return keys
+}
+
 func TestMakeAndValidateJWT_Success(t *testing.T) {
 	userID := uuid.New()
-	secret := "secret"
-	tok, err := MakeJWT(userID, secret, time.Hour)
+	keys := hmacKeyring("secret")
+	tok, err := MakeJWT(userID, keys, time.Hour)
 
 	if err != nil || tok == "" {
 		t.Fatalf("expected token, got err=%v tok=%q", err, tok)
 	}
-	gotID, err := ValidateJWT(tok, secret)
+	gotID, err := ValidateJWT(tok, keys)
 	if err != nil {
 		t.Fatalf("validate err: %v", err)
 	}
@@ -89,26 +126,25 @@ func TestMakeAndValidateJWT_Success(t *testing.T) {
 
 func TestMakeAndValidateJWT_ExpiredToken(t *testing.T) {
 	userID := uuid.New()
-	secret := "secret"
-	tok, _ := MakeJWT(userID, secret, -time.Minute)
+	keys := hmacKeyring("secret")
+	tok, _ := MakeJWT(userID, keys, -time.Minute)
 
-	if _, err := ValidateJWT(tok, secret); err == nil {
+	if _, err := ValidateJWT(tok, keys); err == nil {
 		t.Fatalf("expected error for expired token")
 	}
 }
 
 func TestMakeAndValidateJWT_WrongSecret(t *testing.T) {
 	userID := uuid.New()
-	secret := "secret"
-	tok, _ := MakeJWT(userID, secret, time.Hour)
+	tok, _ := MakeJWT(userID, hmacKeyring("secret"), time.Hour)
 
-	if _, err := ValidateJWT(tok, "wrong"); err == nil {
+	if _, err := ValidateJWT(tok, hmacKeyring("wrong")); err == nil {
 		t.Fatalf("expected error for wrong secret")
 	}
 }
 
 func TestGetBearerToken_Success(t *testing.T) {
-	tok, _ := MakeJWT(uuid.New(), "secret", time.Hour)
+	tok, _ := MakeJWT(uuid.New(), hmacKeyring("secret"), time.Hour)
 
 	header := http.Header{}
 	http.Header.Add(header, "Authorization", "Bearer "+tok)
@@ -137,7 +173,7 @@ func TestGetBearerToken_MissingHeader(t *testing.T) {
 
 func TestGetBearerToken_MissingBearer(t *testing.T) {
 
-	tok, _ := MakeJWT(uuid.New(), "secret", time.Hour)
+	tok, _ := MakeJWT(uuid.New(), hmacKeyring("secret"), time.Hour)
 
 	header := http.Header{}
 	http.Header.Add(header, "Authorization", tok)
@@ -150,7 +186,7 @@ func TestGetBearerToken_MissingBearer(t *testing.T) {
 }
 
 func TestGetBearerToken_WhiteSpace(t *testing.T) {
-	tok, _ := MakeJWT(uuid.New(), "secret", time.Hour)
+	tok, _ := MakeJWT(uuid.New(), hmacKeyring("secret"), time.Hour)
 
 	spacedTok := "  " + tok + "  "
 
@@ -167,3 +203,126 @@ func TestGetBearerToken_WhiteSpace(t *testing.T) {
 		t.Fatalf("expected token=\"%s\", got tok=\"%s\"", tok, tokenString)
 	}
 }
+
+func TestHashToken(t *testing.T) {
+	tok, _ := MakeRefreshToken()
+
+	hash := HashToken(tok)
+
+	if hash == tok {
+		t.Fatalf("expected hash to differ from token")
+	}
+
+	if len(hash) != 64 {
+		t.Fatalf("expected 64 hex characters, got %d", len(hash))
+	}
+
+	if HashToken(tok) != hash {
+		t.Fatalf("expected HashToken to be deterministic")
+	}
+
+	other, _ := MakeRefreshToken()
+	if HashToken(other) == hash {
+		t.Fatalf("expected different tokens to hash differently")
+	}
+}
+
+func TestMakePersonalAccessToken(t *testing.T) {
+	tok, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatalf("MakePersonalAccessToken err = %v", err)
+	}
+
+	if !IsPersonalAccessToken(tok) {
+		t.Fatalf("expected %q to be a personal access token", tok)
+	}
+
+	jwt, _ := MakeJWT(uuid.New(), hmacKeyring("secret"), time.Hour)
+	if IsPersonalAccessToken(jwt) {
+		t.Fatalf("expected a JWT not to be a personal access token")
+	}
+}
+
+func TestMFATokenIsNotAnAccessToken(t *testing.T) {
+	keys := hmacKeyring("secret")
+	userID := uuid.New()
+
+	mfaTok, err := MakeMFAToken(userID, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeMFAToken err = %v", err)
+	}
+
+	if _, err := ValidateJWT(mfaTok, keys); err == nil {
+		t.Fatalf("expected MFA token to be rejected as an access token")
+	}
+
+	gotID, err := ValidateMFAToken(mfaTok, keys)
+	if err != nil || gotID != userID {
+		t.Fatalf("ValidateMFAToken = %v, %v, expected %v", gotID, err, userID)
+	}
+
+	accessTok, _ := MakeJWT(userID, keys, time.Minute)
+	if _, err := ValidateMFAToken(accessTok, keys); err == nil {
+		t.Fatalf("expected access token to be rejected as an MFA token")
+	}
+}
+
+func TestOAuthJWT(t *testing.T) {
+	keys := hmacKeyring("secret")
+	userID, clientID, grantID := uuid.New(), uuid.New(), uuid.New()
+
+	tok, err := MakeOAuthJWT(userID, clientID, grantID, []string{"chirps:read", "chirps:write"}, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeOAuthJWT err = %v", err)
+	}
+
+	if gotID, err := ValidateJWT(tok, keys); err != nil || gotID != userID {
+		t.Fatalf("ValidateJWT = %v, %v, expected %v", gotID, err, userID)
+	}
+
+	claims, err := ParseAccessToken(tok, keys)
+	if err != nil {
+		t.Fatalf("ParseAccessToken err = %v", err)
+	}
+
+	if !claims.IsOAuth() || claims.ClientID != clientID || claims.GrantID != grantID {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	if len(claims.Scopes) != 2 || claims.Scopes[0] != "chirps:read" || claims.Scopes[1] != "chirps:write" {
+		t.Fatalf("Scopes = %v", claims.Scopes)
+	}
+
+	loginTok, _ := MakeJWT(userID, keys, time.Minute)
+	claims, err = ParseAccessToken(loginTok, keys)
+	if err != nil || claims.IsOAuth() || claims.UserID != userID {
+		t.Fatalf("ParseAccessToken(login token) = %+v, %v", claims, err)
+	}
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	// from RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if !VerifyPKCE(verifier, challenge) {
+		t.Fatalf("expected RFC 7636 verifier to match its challenge")
+	}
+
+	if VerifyPKCE(verifier[:len(verifier)-1]+"l", challenge) {
+		t.Fatalf("expected a different verifier not to match")
+	}
+
+	if VerifyPKCE("too-short", challenge) {
+		t.Fatalf("expected a verifier under 43 characters to be rejected")
+	}
+
+	made, err := MakePKCEVerifier()
+	if err != nil || !VerifyPKCE(made, PKCEChallenge(made)) {
+		t.Fatalf("MakePKCEVerifier = %q, %v, expected a verifier that matches its challenge", made, err)
+	}
+
+	if ValidPKCEValue(strings.Repeat("a", 42)+"+") || !ValidPKCEValue(strings.Repeat("a", 43)) {
+		t.Fatalf("ValidPKCEValue accepted or rejected the wrong value")
+	}
+}
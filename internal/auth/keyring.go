@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const minRSAKeyBits = 2048
+
+// Keyring holds the keys used to sign and verify access tokens. Asymmetric
+// keys are identified by a kid, the RFC 7638 thumbprint of the public key,
+// so tokens signed by a retired key still verify as long as its public key
+// stays in the ring.
+type Keyring struct {
+	signer *key
+	hmac   *key
+	keys   map[string]*key
+}
+
+type key struct {
+	id     string
+	method jwt.SigningMethod
+	// signing is nil for verification-only keys
+	signing interface{}
+	verify  interface{}
+}
+
+func NewKeyring() *Keyring {
+	return &Keyring{keys: make(map[string]*key)}
+}
+
+// AddSigningKey makes signer (an RSA or Ed25519 private key) the key new
+// tokens are signed with. It also becomes a verification key.
+func (k *Keyring) AddSigningKey(signer crypto.Signer) (string, error) {
+	sk, err := newKey(signer.Public())
+	if err != nil {
+		return "", err
+	}
+	sk.signing = signer
+
+	k.keys[sk.id] = sk
+	k.signer = sk
+
+	return sk.id, nil
+}
+
+// AddVerificationKey accepts tokens signed by the private half of pub, e.g.
+// a key that was rotated out but may still have live tokens.
+func (k *Keyring) AddVerificationKey(pub crypto.PublicKey) (string, error) {
+	vk, err := newKey(pub)
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := k.keys[vk.id]; !ok {
+		k.keys[vk.id] = vk
+	}
+
+	return vk.id, nil
+}
+
+// AddHMACKey accepts HS256 tokens without a kid, which is how every token was
+// signed before asymmetric keys. New tokens only use it when the ring has no
+// asymmetric signing key. It is never published in the JWKS.
+func (k *Keyring) AddHMACKey(secret string) {
+	k.hmac = &key{
+		method:  jwt.SigningMethodHS256,
+		signing: []byte(secret),
+		verify:  []byte(secret),
+	}
+}
+
+func (k *Keyring) signingKey() (*key, error) {
+	if k.signer != nil {
+		return k.signer, nil
+	}
+	if k.hmac != nil {
+		return k.hmac, nil
+	}
+	return nil, errors.New("keyring has no signing key")
+}
+
+// keyFunc picks the verification key by the token's kid and refuses tokens
+// whose alg doesn't match that key.
+func (k *Keyring) keyFunc(t *jwt.Token) (interface{}, error) {
+	var vk *key
+
+	if kid, ok := t.Header["kid"].(string); ok {
+		vk = k.keys[kid]
+	} else {
+		vk = k.hmac
+	}
+
+	if vk == nil {
+		return nil, fmt.Errorf("unknown signing key")
+	}
+
+	if t.Method.Alg() != vk.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method")
+	}
+
+	return vk.verify, nil
+}
+
+func newKey(pub crypto.PublicKey) (*key, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA keys must be at least %d bits", minRSAKeyBits)
+		}
+		k := &key{method: jwt.SigningMethodRS256, verify: pub}
+		k.id = thumbprint(k.jwk())
+		return k, nil
+	case ed25519.PublicKey:
+		k := &key{method: jwt.SigningMethodEdDSA, verify: pub}
+		k.id = thumbprint(k.jwk())
+		return k, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use RSA or Ed25519", pub)
+	}
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k *key) jwk() JWK {
+	switch pub := k.verify.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(pub),
+		}
+	}
+	return JWK{}
+}
+
+// thumbprint is the RFC 7638 JWK thumbprint: the SHA-256 of the required
+// members in lexicographic order.
+func thumbprint(jwk JWK) string {
+	var members interface{}
+
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// JWKS lists the public half of every asymmetric key, for services that
+// verify Chirpy tokens on their own.
+func (k *Keyring) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+
+	for _, vk := range k.keys {
+		jwk := vk.jwk()
+		jwk.Kid = vk.id
+		jwk.Use = "sig"
+		jwk.Alg = vk.method.Alg()
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].Kid < jwks.Keys[j].Kid
+	})
+
+	return jwks
+}
+
+// ParseKeyPEM reads the first PEM block in data. Private keys may be PKCS#8
+// or PKCS#1 and are returned as a crypto.Signer; public keys must be PKIX.
+func ParseKeyPEM(data []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+func generateKeys(t *testing.T) (*rsa.PrivateKey, ed25519.PrivateKey) {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rsaKey, edKey
+}
+
+func TestKeyringSignAndValidate(t *testing.T) {
+	rsaKey, edKey := generateKeys(t)
+
+	cases := []struct {
+		signer crypto.Signer
+		alg    string
+	}{
+		{signer: rsaKey, alg: "RS256"},
+		{signer: edKey, alg: "EdDSA"},
+	}
+
+	for _, c := range cases {
+		keys := NewKeyring()
+		kid, err := keys.AddSigningKey(c.signer)
+		if err != nil {
+			t.Fatalf("%s: AddSigningKey err = %v", c.alg, err)
+		}
+
+		userID := uuid.New()
+		tok, err := MakeJWT(userID, keys, time.Hour)
+		if err != nil {
+			t.Fatalf("%s: MakeJWT err = %v", c.alg, err)
+		}
+
+		parsed, _, err := jwt.NewParser().ParseUnverified(tok, &jwt.RegisteredClaims{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Header["alg"] != c.alg || parsed.Header["kid"] != kid {
+			t.Errorf("%s: header = %v, expected kid %s", c.alg, parsed.Header, kid)
+		}
+
+		gotID, err := ValidateJWT(tok, keys)
+		if err != nil || gotID != userID {
+			t.Errorf("%s: ValidateJWT = %v, %v, expected %v", c.alg, gotID, err, userID)
+		}
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	oldKey, newKey := generateKeys(t)
+
+	before := NewKeyring()
+	before.AddSigningKey(oldKey)
+
+	oldTok, _ := MakeJWT(uuid.New(), before, time.Hour)
+
+	after := NewKeyring()
+	after.AddSigningKey(newKey)
+
+	if _, err := ValidateJWT(oldTok, after); err == nil {
+		t.Fatalf("expected error for token signed by a key that isn't in the ring")
+	}
+
+	after.AddVerificationKey(oldKey.Public())
+
+	if _, err := ValidateJWT(oldTok, after); err != nil {
+		t.Fatalf("expected token signed by a retired key to validate, got %v", err)
+	}
+
+	newTok, _ := MakeJWT(uuid.New(), after, time.Hour)
+	parsed, _, _ := jwt.NewParser().ParseUnverified(newTok, &jwt.RegisteredClaims{})
+	if parsed.Header["alg"] != "EdDSA" {
+		t.Fatalf("expected new tokens to be signed with the new key, got %v", parsed.Header)
+	}
+}
+
+func TestKeyringLegacyHMAC(t *testing.T) {
+	rsaKey, _ := generateKeys(t)
+
+	keys := NewKeyring()
+	keys.AddHMACKey("secret")
+	kid, _ := keys.AddSigningKey(rsaKey)
+
+	legacyTok, _ := MakeJWT(uuid.New(), hmacKeyring("secret"), time.Hour)
+	if _, err := ValidateJWT(legacyTok, keys); err != nil {
+		t.Fatalf("expected HS256 token to validate during migration, got %v", err)
+	}
+
+	tok, _ := MakeJWT(uuid.New(), keys, time.Hour)
+	parsed, _, _ := jwt.NewParser().ParseUnverified(tok, &jwt.RegisteredClaims{})
+	if parsed.Header["alg"] != "RS256" {
+		t.Fatalf("expected asymmetric key to take precedence over HMAC, got %v", parsed.Header)
+	}
+
+	// an HS256 token naming the RSA key's kid must not be checked against it
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   uuid.New().String(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	forged.Header["kid"] = kid
+	forgedTok, _ := forged.SignedString([]byte("secret"))
+
+	if _, err := ValidateJWT(forgedTok, keys); err == nil {
+		t.Fatalf("expected error for token whose alg doesn't match its kid")
+	}
+
+	// without an HMAC key, HS256 tokens are refused entirely
+	noHMAC := NewKeyring()
+	noHMAC.AddSigningKey(rsaKey)
+	if _, err := ValidateJWT(legacyTok, noHMAC); err == nil {
+		t.Fatalf("expected error for HS256 token when no HMAC key is configured")
+	}
+}
+
+func TestKeyringRejectsWeakKeys(t *testing.T) {
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewKeyring().AddSigningKey(weak); err == nil {
+		t.Fatalf("expected error for 1024 bit RSA key")
+	}
+}
+
+func TestKeyringJWKS(t *testing.T) {
+	rsaKey, edKey := generateKeys(t)
+
+	keys := NewKeyring()
+	keys.AddHMACKey("secret")
+	rsaKid, _ := keys.AddVerificationKey(rsaKey.Public())
+	edKid, _ := keys.AddSigningKey(edKey)
+
+	jwks := keys.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("expected 2 keys, got %d: %+v", len(jwks.Keys), jwks.Keys)
+	}
+
+	byKid := map[string]JWK{}
+	for _, jwk := range jwks.Keys {
+		byKid[jwk.Kid] = jwk
+	}
+
+	if jwk := byKid[rsaKid]; jwk.Kty != "RSA" || jwk.Alg != "RS256" || jwk.Use != "sig" || jwk.N == "" || jwk.E != "AQAB" {
+		t.Errorf("unexpected RSA JWK %+v", jwk)
+	}
+
+	if jwk := byKid[edKid]; jwk.Kty != "OKP" || jwk.Crv != "Ed25519" || jwk.Alg != "EdDSA" || jwk.X == "" {
+		t.Errorf("unexpected Ed25519 JWK %+v", jwk)
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	// RFC 8037, appendix A.3
+	jwk := JWK{Kty: "OKP", Crv: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}
+
+	if got := thumbprint(jwk); got != "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k" {
+		t.Errorf("thumbprint() = %s", got)
+	}
+}
+
+func TestParseKeyPEM(t *testing.T) {
+	rsaKey, edKey := generateKeys(t)
+
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	pkix, _ := x509.MarshalPKIXPublicKey(rsaKey.Public())
+
+	cases := []struct {
+		block   *pem.Block
+		private bool
+	}{
+		{block: &pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}, private: true},
+		{block: &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}, private: true},
+		{block: &pem.Block{Type: "PUBLIC KEY", Bytes: pkix}, private: false},
+	}
+
+	for _, c := range cases {
+		parsed, err := ParseKeyPEM(pem.EncodeToMemory(c.block))
+		if err != nil {
+			t.Fatalf("ParseKeyPEM(%s) err = %v", c.block.Type, err)
+		}
+
+		if _, ok := parsed.(crypto.Signer); ok != c.private {
+			t.Errorf("ParseKeyPEM(%s) returned %T", c.block.Type, parsed)
+		}
+	}
+
+	if _, err := ParseKeyPEM([]byte("not a key")); err == nil {
+		t.Errorf("expected error for data without a PEM block")
+	}
+}
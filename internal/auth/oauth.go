@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AccessClaims describe a valid access token. Tokens from logging in have no
+// ClientID and can do everything; tokens issued to OAuth clients are limited
+// to Scopes and belong to a grant that can be revoked.
+type AccessClaims struct {
+	UserID    uuid.UUID
+	ClientID  uuid.UUID
+	GrantID   uuid.UUID
+	Scopes    []string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// IsOAuth reports whether the token was issued to an OAuth client.
+func (c AccessClaims) IsOAuth() bool {
+	return c.ClientID != uuid.Nil
+}
+
+// MakeOAuthJWT signs an access token that lets clientID act for userID with
+// scopes. ValidateJWT accepts it like any other access token, so callers
+// that care about scopes must use ParseAccessToken.
+func MakeOAuthJWT(userID, clientID, grantID uuid.UUID, scopes []string, keys *Keyring, expiresIn time.Duration) (string, error) {
+	return makeToken(userID, keys, expiresIn, tokenClaims{
+		Scope:    strings.Join(scopes, " "),
+		ClientID: clientID.String(),
+		GrantID:  grantID.String(),
+	})
+}
+
+// ParseAccessToken validates an access token like ValidateJWT and returns
+// all of its claims.
+func ParseAccessToken(tokenString string, keys *Keyring) (AccessClaims, error) {
+	claims, err := parseToken(tokenString, keys)
+	if err != nil {
+		return AccessClaims{}, err
+	}
+
+	if len(claims.Audience) != 0 {
+		return AccessClaims{}, fmt.Errorf("invalid token")
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return AccessClaims{}, fmt.Errorf("invalid token")
+	}
+
+	access := AccessClaims{
+		UserID:    userID,
+		IssuedAt:  claims.IssuedAt.Time,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+
+	if claims.ClientID == "" {
+		return access, nil
+	}
+
+	access.ClientID, err = uuid.Parse(claims.ClientID)
+	if err != nil {
+		return AccessClaims{}, fmt.Errorf("invalid token")
+	}
+
+	access.GrantID, err = uuid.Parse(claims.GrantID)
+	if err != nil {
+		return AccessClaims{}, fmt.Errorf("invalid token")
+	}
+
+	access.Scopes = strings.Fields(claims.Scope)
+
+	return access, nil
+}
+
+// ValidPKCEValue reports whether s can be a PKCE code verifier or S256
+// challenge: 43 to 128 characters from the unreserved set of RFC 7636.
+func ValidPKCEValue(s string) bool {
+	if len(s) < 43 || len(s) > 128 {
+		return false
+	}
+
+	for _, c := range s {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// MakePKCEVerifier returns a random code verifier, for when Chirpy is the
+// client of another authorization server.
+func MakePKCEVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// PKCEChallenge is the S256 challenge for verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyPKCE checks verifier against an S256 challenge.
+func VerifyPKCE(verifier, challenge string) bool {
+	if !ValidPKCEValue(verifier) {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
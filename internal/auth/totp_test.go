@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the SHA1 secret from RFC 6238 appendix B, "12345678901234567890"
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits
+	cases := []struct {
+		unix     int64
+		expected string
+	}{
+		{unix: 59, expected: "287082"},
+		{unix: 1111111109, expected: "081804"},
+		{unix: 1111111111, expected: "050471"},
+		{unix: 1234567890, expected: "005924"},
+		{unix: 2000000000, expected: "279037"},
+	}
+
+	for _, c := range cases {
+		got, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(c.unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode err = %v", err)
+		}
+		if got != c.expected {
+			t.Errorf("TOTPCode at %d = %s, expected %s", c.unix, got, c.expected)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := TOTPStep(now)
+
+	previous, _ := TOTPCode(rfc6238Secret, step-1)
+	current, _ := TOTPCode(rfc6238Secret, step)
+	stale, _ := TOTPCode(rfc6238Secret, step-2)
+
+	if got, ok := ValidateTOTP(rfc6238Secret, current, now); !ok || got != step {
+		t.Errorf("expected current code to match step %d, got %d %v", step, got, ok)
+	}
+
+	if got, ok := ValidateTOTP(rfc6238Secret, previous, now); !ok || got != step-1 {
+		t.Errorf("expected previous code to match step %d, got %d %v", step-1, got, ok)
+	}
+
+	if _, ok := ValidateTOTP(rfc6238Secret, stale, now); ok {
+		t.Errorf("expected code from two periods ago to be rejected")
+	}
+
+	for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, now); ok {
+			t.Errorf("expected %q to be rejected", code)
+		}
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret err = %v", err)
+	}
+
+	if len(secret) != 32 {
+		t.Fatalf("expected 32 base32 characters, got %q", secret)
+	}
+
+	if _, err := TOTPCode(secret, 1); err != nil {
+		t.Fatalf("generated secret could not be used: %v", err)
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI(rfc6238Secret, "Chirpy", "user@example.com")
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("could not parse %q: %v", uri, err)
+	}
+
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" || parsed.Path != "/Chirpy:user@example.com" {
+		t.Errorf("unexpected URI %q", uri)
+	}
+
+	if parsed.Query().Get("secret") != rfc6238Secret || parsed.Query().Get("issuer") != "Chirpy" {
+		t.Errorf("unexpected query in %q", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	code, err := MakeRecoveryCode()
+	if err != nil {
+		t.Fatalf("MakeRecoveryCode err = %v", err)
+	}
+
+	if len(code) != 19 || strings.Count(code, "-") != 3 {
+		t.Fatalf("unexpected recovery code format %q", code)
+	}
+
+	typed := " " + strings.ToUpper(strings.ReplaceAll(code, "-", " ")) + " "
+	if NormalizeRecoveryCode(typed) != NormalizeRecoveryCode(code) {
+		t.Errorf("NormalizeRecoveryCode(%q) = %q, expected %q", typed, NormalizeRecoveryCode(typed), NormalizeRecoveryCode(code))
+	}
+}
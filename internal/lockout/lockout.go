@@ -0,0 +1,145 @@
+// Package lockout slows down and then blocks repeated failed attempts, such
+// as wrong passwords, per key.
+package lockout
+
+import (
+	"context"
+	"time"
+)
+
+// reservationTimeout is how long an attempt can stay pending. Reservations
+// older than that are from requests that never released them, and no longer
+// hold up the attempts after them.
+const reservationTimeout = time.Minute
+
+// State is what a Store keeps per key.
+type State struct {
+	Failures     int
+	BlockedUntil time.Time
+	// Pending counts the attempts that were let through and have not been
+	// released yet.
+	Pending int
+}
+
+// Store keeps failure counts. Reserve and Fail must be atomic, so several
+// instances of the server can share one store.
+type Store interface {
+	// Reserve adds a pending attempt at now and returns the state including
+	// it. Failures before windowStart are forgotten, and so are pending
+	// attempts if the last was reserved before staleBefore.
+	Reserve(ctx context.Context, key string, now, windowStart, staleBefore time.Time) (State, error)
+	Release(ctx context.Context, key string) error
+	// Fail records a failed attempt at now and returns the number of
+	// failures, forgetting earlier ones if the last was before windowStart.
+	Fail(ctx context.Context, key string, now, windowStart time.Time) (int, error)
+	// Block keeps key blocked until at least until; it never shortens a
+	// block.
+	Block(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+type Policy struct {
+	// BaseDelay is how long a key waits after its first failure. The wait
+	// doubles with every failure after that, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// MaxFailures is the number of failures that locks a key out for
+	// LockoutDuration.
+	MaxFailures     int
+	LockoutDuration time.Duration
+	// Window is how long failures are remembered after the last one.
+	Window time.Duration
+}
+
+// delay is how long a key with failures has to wait, and whether that wait
+// is a lockout.
+func (p Policy) delay(failures int) (time.Duration, bool) {
+	if failures <= 0 {
+		return 0, false
+	}
+
+	if failures >= p.MaxFailures {
+		return p.LockoutDuration, true
+	}
+
+	wait := p.BaseDelay
+	for i := 1; i < failures && wait < p.MaxDelay; i++ {
+		wait *= 2
+	}
+
+	return min(wait, p.MaxDelay), false
+}
+
+type Limiter struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+func New(store Store, policy Policy) *Limiter {
+	return &Limiter{store: store, policy: policy, now: time.Now}
+}
+
+// Check returns how long key has to wait before its next attempt, zero if it
+// can try now, and whether it is locked out rather than just slowed down.
+//
+// When it can try now the attempt is reserved, and concurrent attempts are
+// refused as if the reserved ones had already failed, so a burst of guesses
+// can't all get in before the first failure is recorded. The caller must
+// Release the key once the attempt is over, after calling Fail if it failed.
+func (l *Limiter) Check(ctx context.Context, key string) (time.Duration, bool, error) {
+	now := l.now()
+
+	state, err := l.store.Reserve(ctx, key, now, now.Add(-l.policy.Window), now.Add(-reservationTimeout))
+	if err != nil {
+		return 0, false, err
+	}
+
+	wait := state.BlockedUntil.Sub(now)
+	locked := state.Failures >= l.policy.MaxFailures
+
+	if ahead := state.Pending - 1; ahead > 0 {
+		if aheadWait, aheadLocked := l.policy.delay(state.Failures + ahead); aheadWait > wait {
+			wait, locked = aheadWait, aheadLocked
+		}
+	}
+
+	if wait <= 0 {
+		return 0, false, nil
+	}
+
+	if err := l.store.Release(ctx, key); err != nil {
+		return 0, false, err
+	}
+
+	return wait, locked, nil
+}
+
+// Release ends an attempt that Check let through.
+func (l *Limiter) Release(ctx context.Context, key string) error {
+	return l.store.Release(ctx, key)
+}
+
+// Fail records a failed attempt for key and blocks it for as long as the
+// policy says. It returns the same values as Check.
+func (l *Limiter) Fail(ctx context.Context, key string) (time.Duration, bool, error) {
+	now := l.now()
+
+	failures, err := l.store.Fail(ctx, key, now, now.Add(-l.policy.Window))
+	if err != nil {
+		return 0, false, err
+	}
+
+	wait, locked := l.policy.delay(failures)
+
+	if err := l.store.Block(ctx, key, now.Add(wait)); err != nil {
+		return 0, false, err
+	}
+
+	return wait, locked, nil
+}
+
+// Reset forgets every failure for key, which also lifts a lockout.
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.store.Reset(ctx, key)
+}
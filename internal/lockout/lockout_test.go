@@ -0,0 +1,171 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	BaseDelay:       time.Second,
+	MaxDelay:        8 * time.Second,
+	MaxFailures:     6,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+func TestPolicyDelay(t *testing.T) {
+	cases := []struct {
+		failures int
+		wait     time.Duration
+		locked   bool
+	}{
+		{failures: 0, wait: 0},
+		{failures: 1, wait: time.Second},
+		{failures: 2, wait: 2 * time.Second},
+		{failures: 3, wait: 4 * time.Second},
+		{failures: 4, wait: 8 * time.Second},
+		{failures: 5, wait: 8 * time.Second},
+		{failures: 6, wait: 15 * time.Minute, locked: true},
+		{failures: 60, wait: 15 * time.Minute, locked: true},
+	}
+
+	for _, c := range cases {
+		wait, locked := testPolicy.delay(c.failures)
+		if wait != c.wait || locked != c.locked {
+			t.Errorf("delay(%d) = %v, %v, expected %v, %v", c.failures, wait, locked, c.wait, c.locked)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	limiter := New(NewMemoryStore(), testPolicy)
+	limiter.now = func() time.Time { return now }
+
+	if wait, _, _ := limiter.Check(ctx, "a"); wait != 0 {
+		t.Fatalf("expected a new key to be allowed, got wait %v", wait)
+	}
+
+	limiter.Fail(ctx, "a")
+	limiter.Fail(ctx, "a")
+	limiter.Release(ctx, "a")
+
+	if wait, locked, _ := limiter.Check(ctx, "a"); wait != 2*time.Second || locked {
+		t.Fatalf("expected 2s backoff, got %v locked=%v", wait, locked)
+	}
+
+	if wait, _, _ := limiter.Check(ctx, "b"); wait != 0 {
+		t.Fatalf("expected other keys to be unaffected, got wait %v", wait)
+	}
+	limiter.Release(ctx, "b")
+
+	now = now.Add(3 * time.Second)
+	if wait, _, _ := limiter.Check(ctx, "a"); wait != 0 {
+		t.Fatalf("expected backoff to have passed, got wait %v", wait)
+	}
+
+	for i := 0; i < 4; i++ {
+		limiter.Fail(ctx, "a")
+	}
+	limiter.Release(ctx, "a")
+
+	if wait, locked, _ := limiter.Check(ctx, "a"); wait != 15*time.Minute || !locked {
+		t.Fatalf("expected lockout, got %v locked=%v", wait, locked)
+	}
+
+	if err := limiter.Reset(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if wait, _, _ := limiter.Check(ctx, "a"); wait != 0 {
+		t.Fatalf("expected reset to lift the lockout, got wait %v", wait)
+	}
+}
+
+func TestLimiterForgetsOldFailures(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	limiter := New(NewMemoryStore(), testPolicy)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		limiter.Fail(ctx, "a")
+	}
+
+	now = now.Add(2 * time.Hour)
+
+	if wait, locked, _ := limiter.Fail(ctx, "a"); wait != time.Second || locked {
+		t.Fatalf("expected failures outside the window to be forgotten, got %v locked=%v", wait, locked)
+	}
+}
+
+func TestLimiterRefusesConcurrentAttempts(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	limiter := New(NewMemoryStore(), testPolicy)
+	limiter.now = func() time.Time { return now }
+
+	if wait, _, _ := limiter.Check(ctx, "a"); wait != 0 {
+		t.Fatalf("expected the first attempt to be allowed, got wait %v", wait)
+	}
+
+	// the first attempt could still fail, which would make this one wait
+	if wait, _, _ := limiter.Check(ctx, "a"); wait != time.Second {
+		t.Fatalf("expected an attempt behind a pending one to wait 1s, got %v", wait)
+	}
+
+	limiter.Release(ctx, "a")
+
+	if wait, _, _ := limiter.Check(ctx, "a"); wait != 0 {
+		t.Fatalf("expected an attempt to be allowed once the pending one succeeded, got wait %v", wait)
+	}
+	limiter.Release(ctx, "a")
+
+	// a reservation that is never released stops counting eventually
+	limiter.Check(ctx, "b")
+	now = now.Add(reservationTimeout + time.Second)
+
+	if wait, _, _ := limiter.Check(ctx, "b"); wait != 0 {
+		t.Fatalf("expected a stale reservation to be ignored, got wait %v", wait)
+	}
+}
+
+func TestMemoryStoreBlockNeverShortens(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	store := NewMemoryStore()
+	store.Fail(ctx, "a", now, now.Add(-time.Hour))
+	store.Block(ctx, "a", now.Add(15*time.Minute))
+	store.Block(ctx, "a", now.Add(time.Second))
+
+	state, _ := store.Reserve(ctx, "a", now, now.Add(-time.Hour), now.Add(-reservationTimeout))
+	if !state.BlockedUntil.Equal(now.Add(15 * time.Minute)) {
+		t.Fatalf("expected the longer block to stay, got blocked until %v", state.BlockedUntil)
+	}
+}
+
+func TestMemoryStorePrunesExpiredKeys(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	store := NewMemoryStore()
+	store.Fail(ctx, "old", now, now.Add(-time.Hour))
+	store.Block(ctx, "old", now.Add(time.Second))
+
+	now = now.Add(2 * time.Hour)
+	store.Reserve(ctx, "new", now, now.Add(-time.Hour), now.Add(-reservationTimeout))
+
+	if _, ok := store.entries["old"]; ok {
+		t.Fatal("expected a key outside the window to be pruned")
+	}
+
+	if _, ok := store.entries["new"]; !ok {
+		t.Fatal("expected a key with a pending attempt to be kept")
+	}
+}
@@ -0,0 +1,119 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const pruneInterval = time.Minute
+
+// MemoryStore keeps state in this process. It is only right for a single
+// instance; use PostgresStore when several share the load.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastPrune time.Time
+}
+
+type memoryEntry struct {
+	State
+	lastFailure time.Time
+	reservedAt  time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*memoryEntry)}
+}
+
+func (m *MemoryStore) Reserve(ctx context.Context, key string, now, windowStart, staleBefore time.Time) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastPrune) > pruneInterval {
+		m.prune(now, windowStart, staleBefore)
+		m.lastPrune = now
+	}
+
+	entry, ok := m.entries[key]
+	if !ok {
+		entry = &memoryEntry{}
+		m.entries[key] = entry
+	}
+
+	if entry.lastFailure.Before(windowStart) {
+		entry.Failures = 0
+	}
+
+	if entry.reservedAt.Before(staleBefore) {
+		entry.Pending = 0
+	}
+
+	entry.Pending++
+	entry.reservedAt = now
+
+	return entry.State, nil
+}
+
+func (m *MemoryStore) Release(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, ok := m.entries[key]; ok && entry.Pending > 0 {
+		entry.Pending--
+	}
+
+	return nil
+}
+
+func (m *MemoryStore) Fail(ctx context.Context, key string, now, windowStart time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok {
+		entry = &memoryEntry{}
+		m.entries[key] = entry
+	}
+
+	if entry.lastFailure.Before(windowStart) {
+		entry.Failures = 0
+	}
+
+	entry.Failures++
+	entry.lastFailure = now
+
+	return entry.Failures, nil
+}
+
+func (m *MemoryStore) Block(ctx context.Context, key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, ok := m.entries[key]; ok && until.After(entry.BlockedUntil) {
+		entry.BlockedUntil = until
+	}
+
+	return nil
+}
+
+func (m *MemoryStore) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+
+	return nil
+}
+
+// prune drops keys whose last failure is outside the window, that are no
+// longer blocked and that have no live reservations, so the map doesn't grow
+// forever.
+func (m *MemoryStore) prune(now, windowStart, staleBefore time.Time) {
+	for key, entry := range m.entries {
+		if entry.lastFailure.Before(windowStart) && entry.BlockedUntil.Before(now) &&
+			(entry.Pending == 0 || entry.reservedAt.Before(staleBefore)) {
+			delete(m.entries, key)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/7minutech/chirpy/internal/database"
+)
+
+// PostgresStore keeps state in the login_attempts table, so every instance
+// of the server sees the same failures.
+type PostgresStore struct {
+	queries *database.Queries
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+func NewPostgresStore(queries *database.Queries) *PostgresStore {
+	return &PostgresStore{queries: queries}
+}
+
+func (p *PostgresStore) Reserve(ctx context.Context, key string, now, windowStart, staleBefore time.Time) (State, error) {
+	if err := p.maybePrune(ctx, now, windowStart, staleBefore); err != nil {
+		return State{}, err
+	}
+
+	attempt, err := p.queries.ReserveLoginAttempt(ctx, database.ReserveLoginAttemptParams{
+		AttemptKey:  key,
+		ReservedAt:  now,
+		WindowStart: windowStart,
+		StaleBefore: staleBefore,
+	})
+	if err != nil {
+		return State{}, err
+	}
+
+	return State{
+		Failures:     int(attempt.Failures),
+		BlockedUntil: attempt.BlockedUntil.Time,
+		Pending:      int(attempt.Pending),
+	}, nil
+}
+
+func (p *PostgresStore) Release(ctx context.Context, key string) error {
+	return p.queries.ReleaseLoginAttempt(ctx, key)
+}
+
+func (p *PostgresStore) Fail(ctx context.Context, key string, now, windowStart time.Time) (int, error) {
+	failures, err := p.queries.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		AttemptKey:  key,
+		FailedAt:    now,
+		WindowStart: windowStart,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(failures), nil
+}
+
+func (p *PostgresStore) Block(ctx context.Context, key string, until time.Time) error {
+	return p.queries.BlockLoginAttempts(ctx, database.BlockLoginAttemptsParams{
+		AttemptKey:   key,
+		BlockedUntil: sql.NullTime{Time: until, Valid: true},
+	})
+}
+
+func (p *PostgresStore) Reset(ctx context.Context, key string) error {
+	return p.queries.DeleteLoginAttempts(ctx, key)
+}
+
+// maybePrune deletes rows that no longer block or count anything, at most
+// once per pruneInterval from this instance, so the table doesn't grow
+// forever.
+func (p *PostgresStore) maybePrune(ctx context.Context, now, windowStart, staleBefore time.Time) error {
+	p.mu.Lock()
+	if now.Sub(p.lastPrune) <= pruneInterval {
+		p.mu.Unlock()
+		return nil
+	}
+	p.lastPrune = now
+	p.mu.Unlock()
+
+	return p.queries.DeleteExpiredLoginAttempts(ctx, database.DeleteExpiredLoginAttemptsParams{
+		WindowStart: windowStart,
+		Now:         now,
+		StaleBefore: staleBefore,
+	})
+}
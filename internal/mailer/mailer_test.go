@@ -0,0 +1,76 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestOutboxSend(t *testing.T) {
+	dir := t.TempDir()
+	outbox := NewOutbox(dir)
+
+	msgs := []Message{
+		{To: "a@example.com", Subject: "first", Body: "hello"},
+		{To: "b@example.com", Subject: "second", Body: "world"},
+	}
+
+	for _, msg := range msgs {
+		if err := outbox.Send(context.Background(), msg); err != nil {
+			t.Fatalf("Send(%v) err = %v", msg, err)
+		}
+	}
+
+	got := outbox.Messages()
+	if len(got) != len(msgs) {
+		t.Fatalf("Messages() returned %d messages, expected %d", len(got), len(msgs))
+	}
+
+	for i := range msgs {
+		if got[i] != msgs[i] {
+			t.Errorf("Messages()[%d] = %v, expected %v", i, got[i], msgs[i])
+		}
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(msgs) {
+		t.Errorf("outbox wrote %d files, expected %d", len(files), len(msgs))
+	}
+}
+
+func TestOutboxInMemory(t *testing.T) {
+	outbox := NewOutbox("")
+
+	if err := outbox.Send(context.Background(), Message{To: "a@example.com"}); err != nil {
+		t.Fatalf("Send err = %v", err)
+	}
+
+	if got := len(outbox.Messages()); got != 1 {
+		t.Errorf("Messages() returned %d messages, expected 1", got)
+	}
+}
+
+func TestFormatStripsHeaderInjection(t *testing.T) {
+	msg := Message{
+		To:      "a@example.com\r\nBcc: evil@example.com",
+		Subject: "hi\nBcc: evil@example.com",
+		Body:    "line one\nline two",
+	}
+
+	out := string(Format("chirpy@example.com", msg))
+	headers, body, _ := strings.Cut(out, "\r\n\r\n")
+
+	for _, line := range strings.Split(headers, "\r\n") {
+		if strings.HasPrefix(line, "Bcc:") {
+			t.Errorf("Format() let an injected header through: %q", line)
+		}
+	}
+
+	if body != "line one\r\nline two" {
+		t.Errorf("Format() body = %q", body)
+	}
+}
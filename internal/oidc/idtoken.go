@@ -0,0 +1,149 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// clockSkew is how far the provider's clock may be off from ours.
+const clockSkew = time.Minute
+
+// signingMethods are the algorithms ID tokens may be signed with. HMAC and
+// none are never accepted.
+var signingMethods = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// Identity is who the provider says logged in.
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// flexibleBool accepts true and "true", since some providers send
+// email_verified as a string.
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case bool:
+		*b = flexibleBool(v)
+	case string:
+		*b = v == "true"
+	default:
+		*b = false
+	}
+
+	return nil
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce           string       `json:"nonce"`
+	AuthorizedParty string       `json:"azp"`
+	Email           string       `json:"email"`
+	EmailVerified   flexibleBool `json:"email_verified"`
+	Name            string       `json:"name"`
+}
+
+// VerifyIDToken checks the ID token's signature against the provider's keys,
+// that it was issued by the provider for this client and is current, and
+// that it carries nonce.
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (Identity, error) {
+	parser := jwt.NewParser(jwt.WithValidMethods(signingMethods), jwt.WithoutClaimsValidation())
+
+	claims := &idTokenClaims{}
+	_, err := parser.ParseWithClaims(rawIDToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+
+		pub, err := p.keys.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+
+		if !keyMatchesMethod(pub, t.Method) {
+			return nil, fmt.Errorf("key %q can not be used with %s", kid, t.Method.Alg())
+		}
+
+		return pub, nil
+	})
+	if err != nil {
+		return Identity{}, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	if err := p.checkClaims(claims, nonce, time.Now()); err != nil {
+		return Identity{}, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	return Identity{
+		Issuer:        claims.Issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+	}, nil
+}
+
+func (p *Provider) checkClaims(claims *idTokenClaims, nonce string, now time.Time) error {
+	if claims.Issuer != p.config.Issuer {
+		return fmt.Errorf("issuer is %q", claims.Issuer)
+	}
+
+	if claims.Subject == "" {
+		return errors.New("subject is missing")
+	}
+
+	if !claims.VerifyAudience(p.config.ClientID, true) {
+		return errors.New("token is for a different client")
+	}
+
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID {
+		return errors.New("token was issued to a different party")
+	}
+
+	if claims.ExpiresAt == nil || !claims.VerifyExpiresAt(now.Add(-clockSkew), true) {
+		return errors.New("token is expired")
+	}
+
+	if claims.IssuedAt != nil && !claims.VerifyIssuedAt(now.Add(clockSkew), true) {
+		return errors.New("token was issued in the future")
+	}
+
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return errors.New("nonce does not match")
+	}
+
+	return nil
+}
+
+func keyMatchesMethod(pub crypto.PublicKey, method jwt.SigningMethod) bool {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		_, ok := method.(*jwt.SigningMethodRSA)
+		return ok
+	case *ecdsa.PublicKey:
+		m, ok := method.(*jwt.SigningMethodECDSA)
+		return ok && m.CurveBits == pub.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		_, ok := method.(*jwt.SigningMethodEd25519)
+		return ok
+	default:
+		return false
+	}
+}
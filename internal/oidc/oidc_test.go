@@ -0,0 +1,156 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/7minutech/chirpy/internal/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const testRedirectURL = "http://localhost:8080/api/login/oidc/callback"
+
+func discover(t *testing.T, server *oidctest.Server) *Provider {
+	t.Helper()
+
+	provider, err := Discover(context.Background(), Config{
+		Issuer:       server.Issuer(),
+		ClientID:     server.ClientID,
+		ClientSecret: server.ClientSecret,
+		RedirectURL:  testRedirectURL,
+	}, server.Client())
+	if err != nil {
+		t.Fatalf("Discover err = %v", err)
+	}
+
+	return provider
+}
+
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestLoginFlow(t *testing.T) {
+	server := oidctest.NewServer("chirpy", "s3cret")
+	defer server.Close()
+
+	provider := discover(t, server)
+
+	verifier := strings.Repeat("v", 43)
+	redirect, err := server.Authorize(provider.AuthCodeURL("state-1", "nonce-1", challenge(verifier)))
+	if err != nil {
+		t.Fatalf("Authorize err = %v", err)
+	}
+
+	if !strings.HasPrefix(redirect.String(), testRedirectURL) || redirect.Query().Get("state") != "state-1" {
+		t.Fatalf("unexpected redirect %s", redirect)
+	}
+
+	idToken, err := provider.Exchange(context.Background(), redirect.Query().Get("code"), verifier)
+	if err != nil {
+		t.Fatalf("Exchange err = %v", err)
+	}
+
+	identity, err := provider.VerifyIDToken(context.Background(), idToken, "nonce-1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken err = %v", err)
+	}
+
+	if identity.Issuer != server.Issuer() || identity.Subject != "248289761001" ||
+		identity.Email != "jane@example.com" || !identity.EmailVerified {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+
+	if _, err := provider.VerifyIDToken(context.Background(), idToken, "nonce-2"); err == nil {
+		t.Fatalf("expected a different nonce to be rejected")
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	server := oidctest.NewServer("chirpy", "s3cret")
+	defer server.Close()
+
+	provider := discover(t, server)
+
+	redirect, err := server.Authorize(provider.AuthCodeURL("state", "nonce", challenge(strings.Repeat("a", 43))))
+	if err != nil {
+		t.Fatalf("Authorize err = %v", err)
+	}
+
+	if _, err := provider.Exchange(context.Background(), redirect.Query().Get("code"), strings.Repeat("b", 43)); err == nil {
+		t.Fatalf("expected exchange with the wrong verifier to fail")
+	}
+}
+
+func TestDiscoverRejectsWrongIssuer(t *testing.T) {
+	server := oidctest.NewServer("chirpy", "s3cret")
+	defer server.Close()
+
+	_, err := Discover(context.Background(), Config{
+		Issuer:      server.Issuer() + "/",
+		ClientID:    "chirpy",
+		RedirectURL: testRedirectURL,
+	}, server.Client())
+	if err == nil {
+		t.Fatalf("expected a mismatched issuer to be rejected")
+	}
+}
+
+func TestVerifyIDTokenClaims(t *testing.T) {
+	server := oidctest.NewServer("chirpy", "s3cret")
+	defer server.Close()
+
+	provider := discover(t, server)
+	identity := oidctest.Identity{Subject: "user-1", Email: "user@example.com", EmailVerified: true}
+
+	cases := []struct {
+		name   string
+		modify func(jwt.MapClaims)
+		valid  bool
+	}{
+		{name: "valid", modify: func(jwt.MapClaims) {}, valid: true},
+		{name: "string email_verified", modify: func(c jwt.MapClaims) { c["email_verified"] = "true" }, valid: true},
+		{name: "wrong issuer", modify: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{name: "wrong audience", modify: func(c jwt.MapClaims) { c["aud"] = "someone-else" }},
+		{name: "other azp", modify: func(c jwt.MapClaims) {
+			c["aud"] = []string{"chirpy", "someone-else"}
+			c["azp"] = "someone-else"
+		}},
+		{name: "expired", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "no expiry", modify: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "issued in the future", modify: func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() }},
+		{name: "missing nonce", modify: func(c jwt.MapClaims) { delete(c, "nonce") }},
+		{name: "missing subject", modify: func(c jwt.MapClaims) { delete(c, "sub") }},
+	}
+
+	for _, c := range cases {
+		claims := server.IDTokenClaims(identity, "nonce")
+		c.modify(claims)
+
+		_, err := provider.VerifyIDToken(context.Background(), server.SignIDToken(claims), "nonce")
+		if (err == nil) != c.valid {
+			t.Errorf("%s: VerifyIDToken err = %v, expected valid = %t", c.name, err, c.valid)
+		}
+	}
+}
+
+func TestVerifyIDTokenRejectsHMAC(t *testing.T) {
+	server := oidctest.NewServer("chirpy", "s3cret")
+	defer server.Close()
+
+	provider := discover(t, server)
+
+	// signed with the client secret, which an attacker might know from a
+	// leaked config, instead of the provider's key
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, server.IDTokenClaims(oidctest.Identity{Subject: "x"}, "nonce"))
+	signed, _ := token.SignedString([]byte(server.ClientSecret))
+
+	if _, err := provider.VerifyIDToken(context.Background(), signed, "nonce"); err == nil {
+		t.Fatalf("expected an HS256 id token to be rejected")
+	}
+}
@@ -0,0 +1,116 @@
+package passwords
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// prefixLength is how many hex characters of a SHA-1 pick its range, the same
+// split the Pwned Passwords range API uses.
+const prefixLength = 5
+
+// BreachedList is a local set of breached passwords, kept as SHA-1 hashes
+// grouped by prefix. Lookups go through Range, so they work the same way as
+// a k-anonymity query to a remote service would: only the prefix is asked
+// for, and the suffix is matched by the caller.
+type BreachedList struct {
+	ranges map[string]map[string]struct{}
+	size   int
+}
+
+// LoadBreachedList reads the file at path. Each line is either a SHA-1 hash
+// in hex, optionally followed by ":count" as in the Pwned Passwords
+// downloads, or a password in plain text. Blank lines are skipped.
+func LoadBreachedList(path string) (*BreachedList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list, err := ReadBreachedList(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return list, nil
+}
+
+func ReadBreachedList(r io.Reader) (*BreachedList, error) {
+	list := &BreachedList{ranges: make(map[string]map[string]struct{})}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		hash, _, _ := strings.Cut(line, ":")
+		if !isSHA1Hex(hash) {
+			hash = hashPassword(line)
+		}
+
+		list.add(strings.ToUpper(hash))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// Len is the number of distinct hashes in the list.
+func (b *BreachedList) Len() int {
+	return b.size
+}
+
+// Range returns the suffixes of every hash in the list that starts with
+// prefix. The map must not be changed.
+func (b *BreachedList) Range(prefix string) map[string]struct{} {
+	return b.ranges[strings.ToUpper(prefix)]
+}
+
+func (b *BreachedList) Contains(password string) bool {
+	hash := hashPassword(password)
+
+	_, ok := b.Range(hash[:prefixLength])[hash[prefixLength:]]
+	return ok
+}
+
+func (b *BreachedList) add(hash string) {
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+
+	suffixes, ok := b.ranges[prefix]
+	if !ok {
+		suffixes = make(map[string]struct{})
+		b.ranges[prefix] = suffixes
+	}
+
+	if _, ok := suffixes[suffix]; !ok {
+		suffixes[suffix] = struct{}{}
+		b.size++
+	}
+}
+
+func hashPassword(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != 2*sha1.Size {
+		return false
+	}
+
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
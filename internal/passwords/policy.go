@@ -0,0 +1,87 @@
+// Package passwords decides whether a new password is acceptable.
+package passwords
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Violation is one reason a password was rejected. Code is stable for
+// clients to match on; Message is for people.
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+const (
+	CodeTooShort = "too_short"
+	CodeTooLong  = "too_long"
+	CodeIsEmail  = "matches_email"
+	CodeBreached = "breached"
+)
+
+type Policy struct {
+	// Lengths are counted in characters. MaxLength keeps the cost of hashing
+	// bounded.
+	MinLength int
+	MaxLength int
+	// Breached is checked when it is set.
+	Breached *BreachedList
+}
+
+func DefaultPolicy() Policy {
+	return Policy{MinLength: 8, MaxLength: 128}
+}
+
+// Check returns every rule password breaks for the account with email, or
+// nothing if it is acceptable.
+func (p Policy) Check(password, email string) []Violation {
+	var violations []Violation
+
+	length := utf8.RuneCountInString(password)
+
+	if length < p.MinLength {
+		violations = append(violations, Violation{
+			Code:    CodeTooShort,
+			Message: fmt.Sprintf("password must be at least %d characters", p.MinLength),
+		})
+	}
+
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, Violation{
+			Code:    CodeTooLong,
+			Message: fmt.Sprintf("password must be at most %d characters", p.MaxLength),
+		})
+	}
+
+	if matchesEmail(password, email) {
+		violations = append(violations, Violation{
+			Code:    CodeIsEmail,
+			Message: "password can not be your email address",
+		})
+	}
+
+	if p.Breached != nil && p.Breached.Contains(password) {
+		violations = append(violations, Violation{
+			Code:    CodeBreached,
+			Message: "password has appeared in a data breach, choose another",
+		})
+	}
+
+	return violations
+}
+
+// matchesEmail catches the whole address and its local part, in any case.
+func matchesEmail(password, email string) bool {
+	if email == "" || password == "" {
+		return false
+	}
+
+	if strings.EqualFold(password, email) {
+		return true
+	}
+
+	local, _, ok := strings.Cut(email, "@")
+	return ok && strings.EqualFold(password, local)
+}
@@ -0,0 +1,80 @@
+package passwords
+
+import (
+	"strings"
+	"testing"
+)
+
+func codes(violations []Violation) string {
+	var c []string
+	for _, v := range violations {
+		c = append(c, v.Code)
+	}
+	return strings.Join(c, ",")
+}
+
+func TestPolicyCheck(t *testing.T) {
+	breached, err := ReadBreachedList(strings.NewReader("hunter2hunter2\n"))
+	if err != nil {
+		t.Fatalf("ReadBreachedList err = %v", err)
+	}
+
+	policy := Policy{MinLength: 8, MaxLength: 16, Breached: breached}
+
+	cases := []struct {
+		password string
+		email    string
+		expected string
+	}{
+		{password: "correct horse", email: "user@example.com", expected: ""},
+		{password: "", email: "user@example.com", expected: CodeTooShort},
+		{password: "short", email: "user@example.com", expected: CodeTooShort},
+		{password: "ééééééé", email: "user@example.com", expected: CodeTooShort},
+		{password: "this one is far too long", email: "user@example.com", expected: CodeTooLong},
+		{password: "User@Example.com", email: "user@example.com", expected: CodeIsEmail},
+		{password: "USERNAME", email: "username@example.com", expected: CodeIsEmail},
+		{password: "user", email: "user@example.com", expected: CodeTooShort + "," + CodeIsEmail},
+		{password: "hunter2hunter2", email: "user@example.com", expected: CodeBreached},
+	}
+
+	for _, c := range cases {
+		if got := codes(policy.Check(c.password, c.email)); got != c.expected {
+			t.Errorf("Check(%q, %q) = %q, expected %q", c.password, c.email, got, c.expected)
+		}
+	}
+}
+
+func TestReadBreachedList(t *testing.T) {
+	input := strings.Join([]string{
+		// sha1("password") as in the Pwned Passwords downloads
+		"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824",
+		// sha1("123456") in lower case without a count
+		"7c4a8d09ca3762af61e59520943dc26494f8941b",
+		"letmein\r",
+		"",
+		"letmein",
+	}, "\n")
+
+	list, err := ReadBreachedList(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ReadBreachedList err = %v", err)
+	}
+
+	if list.Len() != 3 {
+		t.Errorf("Len() = %d, expected 3", list.Len())
+	}
+
+	for _, password := range []string{"password", "123456", "letmein"} {
+		if !list.Contains(password) {
+			t.Errorf("expected %q to be breached", password)
+		}
+	}
+
+	if list.Contains("correct horse battery staple") {
+		t.Errorf("expected an unlisted password not to be breached")
+	}
+
+	if _, ok := list.Range("5baa6")["1E4C9B93F3F0682250B6CF8331B7EE68FD8"]; !ok {
+		t.Errorf("expected Range to find the suffix of sha1(\"password\")")
+	}
+}
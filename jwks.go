@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/7minutech/chirpy/internal/auth"
+)
+
+// loadKeyring builds the access token keyring. Tokens are signed with the
+// private key in signingKeyFile when one is given, and with the HS256 secret
+// otherwise. verificationKeyFiles are keys that were rotated out; tokens they
+// signed are accepted until they expire. Keeping the secret set alongside a
+// signing key lets HS256 tokens issued before the switch keep working.
+func loadKeyring(secret, signingKeyFile, verificationKeyFiles string) (*auth.Keyring, error) {
+	keys := auth.NewKeyring()
+
+	if secret != "" {
+		keys.AddHMACKey(secret)
+	}
+
+	if signingKeyFile != "" {
+		parsed, err := readKeyFile(signingKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%s does not contain a private key", signingKeyFile)
+		}
+
+		kid, err := keys.AddSigningKey(signer)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", signingKeyFile, err)
+		}
+		log.Printf("Signing access tokens with key %s", kid)
+	}
+
+	for _, path := range strings.Split(verificationKeyFiles, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		parsed, err := readKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		pub := crypto.PublicKey(parsed)
+		if signer, ok := parsed.(crypto.Signer); ok {
+			pub = signer.Public()
+		}
+
+		if _, err := keys.AddVerificationKey(pub); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if secret == "" && signingKeyFile == "" {
+		return nil, fmt.Errorf("set Secret or JWT_SIGNING_KEY_FILE to sign access tokens")
+	}
+
+	return keys, nil
+}
+
+func readKeyFile(path string) (interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := auth.ParseKeyPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return parsed, nil
+}
+
+func (apiCfg *apiConfig) handlerJWKS(w http.ResponseWriter, r *http.Request) {
+
+	defer r.Body.Close()
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	respondWithJSON(w, http.StatusOK, apiCfg.jwtKeys.JWKS())
+}
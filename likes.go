@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (apiCfg *apiConfig) handlerLikeChirp(w http.ResponseWriter, r *http.Request) {
+
+	defer r.Body.Close()
+
+	userID, err := apiCfg.authenticate(r, scopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		msg := "could not parse chirp id"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	dbChirp, err := apiCfg.dbQueries.GetChirp(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := "chirp does not exist"
+		respondWithError(w, http.StatusNotFound, msg, err)
+		return
+	}
+
+	if err != nil {
+		msg := "could not get chirp"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	likeParams := database.LikeChirpParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	}
+
+	liked, err := apiCfg.dbQueries.LikeChirp(r.Context(), likeParams)
+	if err != nil {
+		msg := "could not like chirp"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	// notifications are unique per event, so liking the chirp again after
+	// unliking it doesn't notify its author a second time
+	if liked > 0 {
+		if err := notify(r.Context(), apiCfg.dbQueries, dbChirp.UserID, userID, notificationKindLike, dbChirp.ID); err != nil {
+			msg := "could not create notification"
+			respondWithError(w, http.StatusInternalServerError, msg, err)
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusNoContent, nil)
+}
+
+func (apiCfg *apiConfig) handlerUnlikeChirp(w http.ResponseWriter, r *http.Request) {
+
+	defer r.Body.Close()
+
+	userID, err := apiCfg.authenticate(r, scopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		msg := "could not parse chirp id"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	unlikeParams := database.UnlikeChirpParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	}
+
+	if err := apiCfg.dbQueries.UnlikeChirp(r.Context(), unlikeParams); err != nil {
+		msg := "could not unlike chirp"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusNoContent, nil)
+}
+
+func (apiCfg *apiConfig) handlerGetUserLikes(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		msg := "could not parse user id"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	dbChirps, err := apiCfg.dbQueries.GetLikedChirpsByUser(r.Context(), userID)
+	if err != nil {
+		msg := "could not get liked chirps"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	chirps := mapChirp(dbChirps)
+
+	if err := apiCfg.populateChirps(r.Context(), chirps, apiCfg.viewerID(r)); err != nil {
+		msg := "could not get chirp details"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chirps)
+}
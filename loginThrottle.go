@@ -0,0 +1,245 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/7minutech/chirpy/internal/auth"
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/7minutech/chirpy/internal/lockout"
+	"github.com/google/uuid"
+)
+
+// accountLoginPolicy slows down guessing one account's password and locks
+// the account for a while after too many wrong guesses.
+var accountLoginPolicy = lockout.Policy{
+	BaseDelay:       time.Second,
+	MaxDelay:        5 * time.Minute,
+	MaxFailures:     10,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+// ipLoginPolicy is looser, since many users can share an address, but still
+// stops one client from spraying guesses across many accounts.
+var ipLoginPolicy = lockout.Policy{
+	BaseDelay:       0,
+	MaxDelay:        0,
+	MaxFailures:     50,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+// newLoginLimiters picks the store for failed logins and password reset
+// requests. Postgres is needed when more than one instance serves them,
+// otherwise each would count its own.
+func newLoginLimiters(backend string, queries *database.Queries) (account, ip, reset *lockout.Limiter, err error) {
+	var store lockout.Store
+
+	switch backend {
+	case "", "memory":
+		store = lockout.NewMemoryStore()
+	case "postgres":
+		store = lockout.NewPostgresStore(queries)
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown login limiter %q, must be memory or postgres", backend)
+	}
+
+	account = lockout.New(store, accountLoginPolicy)
+	ip = lockout.New(store, ipLoginPolicy)
+	reset = lockout.New(store, passwordResetPolicy)
+
+	return account, ip, reset, nil
+}
+
+func accountLoginKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipLoginKey(r *http.Request) string {
+	return "ip:" + clientIP(r)
+}
+
+// setRetryAfter tells the client how many whole seconds to wait.
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+}
+
+func respondWithRetryAfter(w http.ResponseWriter, code int, wait time.Duration, msg string) {
+	setRetryAfter(w, wait)
+	respondWithError(w, code, msg, nil)
+}
+
+// loginRefusal is why a login attempt is turned away before the password
+// is even checked.
+type loginRefusal struct {
+	code int
+	wait time.Duration
+	msg  string
+}
+
+// loginThrottle returns a refusal when either the client's address or the
+// account has to wait before trying again, and nil when it can try now. An
+// attempt that can try now is reserved until releaseLoginThrottle is called,
+// which callers should defer.
+func (apiCfg *apiConfig) loginThrottle(r *http.Request, email string) (*loginRefusal, error) {
+	wait, _, err := apiCfg.ipLimiter.Check(r.Context(), ipLoginKey(r))
+	if err != nil {
+		return nil, err
+	}
+
+	if wait > 0 {
+		msg := "too many failed logins from this address, try again later"
+		return &loginRefusal{code: http.StatusTooManyRequests, wait: wait, msg: msg}, nil
+	}
+
+	wait, locked, err := apiCfg.accountLimiter.Check(r.Context(), accountLoginKey(email))
+	if err == nil && wait > 0 {
+		err = apiCfg.ipLimiter.Release(r.Context(), ipLoginKey(r))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if locked {
+		msg := "account is temporarily locked after too many failed logins"
+		return &loginRefusal{code: http.StatusLocked, wait: wait, msg: msg}, nil
+	}
+
+	if wait > 0 {
+		msg := "too many failed logins, try again later"
+		return &loginRefusal{code: http.StatusTooManyRequests, wait: wait, msg: msg}, nil
+	}
+
+	return nil, nil
+}
+
+// releaseLoginThrottle ends an attempt loginThrottle let through. Failures
+// must be recorded before it is called, or the next attempt could slip in
+// between.
+func (apiCfg *apiConfig) releaseLoginThrottle(r *http.Request, email string) {
+	if err := apiCfg.ipLimiter.Release(r.Context(), ipLoginKey(r)); err != nil {
+		log.Printf("Error releasing login attempt: %s", err)
+	}
+
+	if err := apiCfg.accountLimiter.Release(r.Context(), accountLoginKey(email)); err != nil {
+		log.Printf("Error releasing login attempt: %s", err)
+	}
+}
+
+// checkLoginThrottle is loginThrottle for JSON endpoints. It responds and
+// returns false when the attempt is refused.
+func (apiCfg *apiConfig) checkLoginThrottle(w http.ResponseWriter, r *http.Request, email string) bool {
+	refusal, err := apiCfg.loginThrottle(r, email)
+	if err != nil {
+		msg := "could not check login attempts"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return false
+	}
+
+	if refusal != nil {
+		respondWithRetryAfter(w, refusal.code, refusal.wait, refusal.msg)
+		return false
+	}
+
+	return true
+}
+
+// recordLoginFailure counts a failed attempt against the client's address
+// and the account, and returns how long until the next attempt is allowed.
+func (apiCfg *apiConfig) recordLoginFailure(r *http.Request, email string) (time.Duration, error) {
+	ipWait, _, err := apiCfg.ipLimiter.Fail(r.Context(), ipLoginKey(r))
+	if err != nil {
+		return 0, err
+	}
+
+	accountWait, _, err := apiCfg.accountLimiter.Fail(r.Context(), accountLoginKey(email))
+	if err != nil {
+		return 0, err
+	}
+
+	return max(ipWait, accountWait), nil
+}
+
+// failLogin records a failed attempt, then responds with msg. Retry-After is
+// set when the next attempt will be refused.
+func (apiCfg *apiConfig) failLogin(w http.ResponseWriter, r *http.Request, email, msg string, cause error) {
+	apiCfg.failAttempt(w, r, http.StatusUnauthorized, email, msg, cause)
+}
+
+// failReauth is failLogin for a signed in user who got their password or
+// code wrong while confirming an action. Their session is still good, so it
+// responds 403 instead of 401.
+func (apiCfg *apiConfig) failReauth(w http.ResponseWriter, r *http.Request, email, msg string, cause error) {
+	apiCfg.failAttempt(w, r, http.StatusForbidden, email, msg, cause)
+}
+
+func (apiCfg *apiConfig) failAttempt(w http.ResponseWriter, r *http.Request, code int, email, msg string, cause error) {
+	wait, err := apiCfg.recordLoginFailure(r, email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not record login attempt", err)
+		return
+	}
+
+	if wait > 0 {
+		setRetryAfter(w, wait)
+	}
+
+	respondWithError(w, code, msg, cause)
+}
+
+func (apiCfg *apiConfig) handlerUnlockUser(w http.ResponseWriter, r *http.Request) {
+
+	defer r.Body.Close()
+
+	apiKey, err := auth.GetAPIKey(r.Header)
+	if err != nil {
+		msg := "missing header"
+		respondWithError(w, http.StatusUnauthorized, msg, err)
+		return
+	}
+
+	if apiCfg.adminKey == "" || subtle.ConstantTimeCompare([]byte(apiKey), []byte(apiCfg.adminKey)) != 1 {
+		msg := "invalid api key"
+		respondWithError(w, http.StatusUnauthorized, msg, nil)
+		return
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		msg := "could not parse user id"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	user, err := apiCfg.dbQueries.GetUser(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := "user does not exist"
+		respondWithError(w, http.StatusNotFound, msg, err)
+		return
+	}
+
+	if err != nil {
+		msg := "could not get user"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if err := apiCfg.accountLimiter.Reset(r.Context(), accountLoginKey(user.Email)); err != nil {
+		msg := "could not unlock user"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusNoContent, nil)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -8,12 +9,17 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"sort"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/7minutech/chirpy/internal/auth"
 	"github.com/7minutech/chirpy/internal/database"
+	"github.com/7minutech/chirpy/internal/lockout"
+	"github.com/7minutech/chirpy/internal/mailer"
+	"github.com/7minutech/chirpy/internal/oidc"
+	"github.com/7minutech/chirpy/internal/passwords"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -21,34 +27,61 @@ import (
 
 const expirationDays = 60
 
+const maxChirpLength int = 140
+
 type apiConfig struct {
 	fileserverHits atomic.Int32
+	db             *sql.DB
 	dbQueries      *database.Queries
 	platform       string
-	secret         string
+	jwtKeys        *auth.Keyring
 	polkaKey       string
+	mailer         mailer.Mailer
+	adminKey       string
+	accountLimiter *lockout.Limiter
+	ipLimiter      *lockout.Limiter
+	resetLimiter   *lockout.Limiter
+	passwordParams *auth.PasswordParams
+	passwordPolicy passwords.Policy
+	oidc           *oidc.Provider
 }
 
 type User struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	Email        string    `json:"email"`
-	Token        string    `json:"token"`
-	RefreshToken string    `json:"refresh_token"`
-	Red          bool      `json:"is_chirpy_red"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	Handle        string    `json:"handle"`
+	DisplayName   string    `json:"display_name"`
+	Bio           string    `json:"bio"`
+	Location      string    `json:"location"`
+	TwoFactor     bool      `json:"two_factor_enabled"`
+	Token         string    `json:"token"`
+	RefreshToken  string    `json:"refresh_token"`
+	Red           bool      `json:"is_chirpy_red"`
 }
 
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID              uuid.UUID     `json:"id"`
+	CreatedAt       time.Time     `json:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+	Body            string        `json:"body"`
+	UserID          uuid.UUID     `json:"user_id"`
+	InReplyTo       uuid.NullUUID `json:"in_reply_to"`
+	Kind            string        `json:"kind"`
+	RechirpOf       uuid.NullUUID `json:"rechirp_of"`
+	QuoteOf         uuid.NullUUID `json:"quote_of"`
+	ReferencedChirp *Chirp        `json:"referenced_chirp,omitempty"`
+	Edited          bool          `json:"edited"`
+	ReplyCount      int64         `json:"reply_count"`
+	LikeCount       int64         `json:"like_count"`
+	LikedByMe       bool          `json:"liked_by_me"`
 }
 
 type JWT struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
 }
 
 func (apiCfg *apiConfig) handlerMetric(w http.ResponseWriter, r *http.Request) {
@@ -96,6 +129,7 @@ func (apiCfg *apiConfig) handerUser(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Password string `json:"password"`
 		Email    string `json:"email"`
+		Handle   string `json:"handle"`
 	}
 
 	var params = parameters{}
@@ -108,7 +142,23 @@ func (apiCfg *apiConfig) handerUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
+	if !validEmail(params.Email) {
+		msg := "email is not a valid address"
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	if params.Handle != "" && !handlePattern.MatchString(params.Handle) {
+		msg := "handle must be 3 to 30 letters, numbers or underscores"
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	if !apiCfg.checkPassword(w, params.Password, params.Email) {
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(params.Password, apiCfg.passwordParams)
 	if err != nil {
 		msg := "could not hash password"
 		respondWithError(w, http.StatusBadRequest, msg, err)
@@ -117,10 +167,27 @@ func (apiCfg *apiConfig) handerUser(w http.ResponseWriter, r *http.Request) {
 
 	userParams := database.CreateUserParams{
 		Email:          params.Email,
-		HashedPassword: hashedPassword,
+		HashedPassword: sql.NullString{String: hashedPassword, Valid: true},
+		Handle:         sql.NullString{String: params.Handle, Valid: params.Handle != ""},
 	}
 
-	user, err := apiCfg.dbQueries.CreateUser(r.Context(), userParams)
+	tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		msg := "could not start transaction"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := apiCfg.dbQueries.WithTx(tx)
+
+	user, err := qtx.CreateUser(r.Context(), userParams)
+
+	if isUniqueViolation(err) {
+		msg := "email or handle is already taken"
+		respondWithError(w, http.StatusConflict, msg, err)
+		return
+	}
 
 	if err != nil {
 		msg := "could not create user"
@@ -128,22 +195,40 @@ func (apiCfg *apiConfig) handerUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp := User{
-		ID:        user.ID,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-		Email:     user.Email,
-		Red:       user.IsChirpyRed,
+	verificationToken, err := createVerificationToken(r.Context(), qtx, user.ID)
+	if err != nil {
+		msg := "could not create verification token"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
 	}
 
+	if err := tx.Commit(); err != nil {
+		msg := "could not create user"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	apiCfg.sendVerificationEmail(r.Context(), user.Email, verificationToken)
+
+	resp := convertUser(user)
+
 	respondWithJSON(w, http.StatusCreated, resp)
 }
 
 func (apiCfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request) {
 
+	userID, err := apiCfg.authenticate(r, scopeProfileWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	// every field is optional, nil fields are left unchanged
 	type parameters struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+		Email           *string `json:"email"`
+		Password        *string `json:"password"`
+		CurrentPassword string  `json:"current_password"`
+		profileUpdate
 	}
 
 	var params = parameters{}
@@ -156,72 +241,152 @@ func (apiCfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
-	if err != nil {
-		msg := "could not hash password"
-		respondWithError(w, http.StatusBadRequest, msg, err)
+	if params.Email != nil && !validEmail(*params.Email) {
+		msg := "email is not a valid address"
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	if err := params.profileUpdate.validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
+	user, err := apiCfg.dbQueries.GetUser(r.Context(), userID)
 	if err != nil {
-		msg := "could not get token"
-		respondWithError(w, http.StatusUnauthorized, msg, err)
+		msg := "could not get user"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, apiCfg.secret)
+	// changing the email or password needs the current password, so a stolen
+	// access token can't be used to take over the account
+	if params.Email != nil || params.Password != nil {
+		if _, err := apiCfg.authenticateSession(r); err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		if !checkHasPassword(w, user) {
+			return
+		}
+
+		ok, err := auth.CheckPasswordHash(params.CurrentPassword, user.HashedPassword.String)
+		if !ok || err != nil {
+			msg := "current_password is incorrect"
+			respondWithError(w, http.StatusForbidden, msg, err)
+			return
+		}
+	}
+
+	var hashedPassword string
+
+	if params.Password != nil {
+		email := user.Email
+		if params.Email != nil {
+			email = *params.Email
+		}
+
+		if !apiCfg.checkPassword(w, *params.Password, email) {
+			return
+		}
+
+		hashedPassword, err = auth.HashPassword(*params.Password, apiCfg.passwordParams)
+		if err != nil {
+			msg := "could not hash password"
+			respondWithError(w, http.StatusBadRequest, msg, err)
+			return
+		}
+	}
+
+	tx, err := apiCfg.db.BeginTx(r.Context(), nil)
 	if err != nil {
-		msg := "could not validate token"
-		respondWithError(w, http.StatusUnauthorized, msg, err)
+		msg := "could not start transaction"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
 		return
 	}
+	defer tx.Rollback()
 
-	userParams := database.UpdateUserParams{
-		Email:          params.Email,
-		HashedPassword: hashedPassword,
-		ID:             userID,
+	qtx := apiCfg.dbQueries.WithTx(tx)
+
+	// a new email address has to be verified again
+	var verificationToken string
+
+	if params.Email != nil {
+		user, err = qtx.UpdateUserEmail(r.Context(), database.UpdateUserEmailParams{
+			Email: *params.Email,
+			ID:    userID,
+		})
+		if err == nil {
+			verificationToken, err = createVerificationToken(r.Context(), qtx, userID)
+		}
+	}
+
+	if err == nil && params.Password != nil {
+		user, err = qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+			HashedPassword: sql.NullString{String: hashedPassword, Valid: true},
+			ID:             userID,
+		})
+	}
+
+	if err == nil && !params.profileUpdate.empty() {
+		user, err = qtx.UpdateUserProfile(r.Context(), params.profileUpdate.params(userID))
+	}
+
+	if isUniqueViolation(err) {
+		msg := "email or handle is already taken"
+		respondWithError(w, http.StatusConflict, msg, err)
+		return
 	}
 
-	user, err := apiCfg.dbQueries.UpdateUser(r.Context(), userParams)
 	if err != nil {
 		msg := "could not update user"
 		respondWithError(w, http.StatusInternalServerError, msg, err)
 		return
 	}
 
-	resp := User{
-		ID:        user.ID,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-		Email:     user.Email,
-		Red:       user.IsChirpyRed,
+	if err := tx.Commit(); err != nil {
+		msg := "could not update user"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if verificationToken != "" {
+		apiCfg.sendVerificationEmail(r.Context(), user.Email, verificationToken)
 	}
 
+	resp := convertUser(user)
+
 	respondWithJSON(w, http.StatusOK, resp)
 }
 
 func (apiCfg *apiConfig) handlerValidateChirp(w http.ResponseWriter, r *http.Request) {
 
-	tok, err := auth.GetBearerToken(r.Header)
+	userID, err := apiCfg.authenticate(r, scopeChirpsWrite)
 	if err != nil {
-		msg := "token was not given in headers"
-		respondWithError(w, http.StatusBadRequest, msg, err)
+		respondWithAuthError(w, err)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(tok, apiCfg.secret)
+	author, err := apiCfg.dbQueries.GetUser(r.Context(), userID)
 	if err != nil {
-		msg := "token was not valid"
-		respondWithError(w, http.StatusUnauthorized, msg, err)
+		msg := "could not get user"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
 		return
 	}
 
-	type parameters struct {
-		Body string `json:"body"`
+	if !author.EmailVerifiedAt.Valid {
+		msg := "email must be verified before posting"
+		respondWithError(w, http.StatusForbidden, msg, nil)
+		return
 	}
 
-	const maxChirpLength int = 140
+	type parameters struct {
+		Body      string        `json:"body"`
+		InReplyTo uuid.NullUUID `json:"in_reply_to"`
+		RechirpOf uuid.NullUUID `json:"rechirp_of"`
+		QuoteOf   uuid.NullUUID `json:"quote_of"`
+	}
 
 	var params parameters
 
@@ -237,40 +402,167 @@ func (apiCfg *apiConfig) handlerValidateChirp(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	var parent database.Chirp
+
+	if params.InReplyTo.Valid {
+		parent, err = apiCfg.dbQueries.GetChirp(r.Context(), params.InReplyTo.UUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "chirp being replied to does not exist", err)
+			return
+		}
+
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "could not get chirp being replied to", err)
+			return
+		}
+	}
+
+	kind := chirpKindChirp
+
+	if params.RechirpOf.Valid {
+		if params.InReplyTo.Valid || params.QuoteOf.Valid {
+			respondWithError(w, http.StatusBadRequest, "rechirp can not reply to or quote a chirp", nil)
+			return
+		}
+
+		if params.Body != "" {
+			respondWithError(w, http.StatusBadRequest, "rechirp can not have a body", nil)
+			return
+		}
+
+		original, err := apiCfg.dbQueries.GetChirp(r.Context(), params.RechirpOf.UUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "chirp being rechirped does not exist", err)
+			return
+		}
+
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "could not get chirp being rechirped", err)
+			return
+		}
+
+		// rechirping a rechirp reposts the chirp it points at
+		if original.RechirpOf.Valid {
+			params.RechirpOf = original.RechirpOf
+		}
+
+		rechirpParams := database.GetRechirpParams{
+			UserID:    userID,
+			RechirpOf: params.RechirpOf.UUID,
+		}
+
+		_, err = apiCfg.dbQueries.GetRechirp(r.Context(), rechirpParams)
+		if err == nil {
+			respondWithError(w, http.StatusConflict, "chirp was already rechirped", nil)
+			return
+		}
+
+		if !errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusInternalServerError, "could not get rechirp", err)
+			return
+		}
+
+		kind = chirpKindRechirp
+	}
+
+	if params.QuoteOf.Valid {
+		if strings.TrimSpace(params.Body) == "" {
+			msg := "quote must have a body"
+			respondWithError(w, http.StatusBadRequest, msg, nil)
+			return
+		}
+
+		quoted, err := apiCfg.dbQueries.GetChirp(r.Context(), params.QuoteOf.UUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "chirp being quoted does not exist", err)
+			return
+		}
+
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "could not get chirp being quoted", err)
+			return
+		}
+
+		if quoted.RechirpOf.Valid {
+			params.QuoteOf = quoted.RechirpOf
+		}
+
+		kind = chirpKindQuote
+	}
+
 	cleanedBody := cleanProfanity(params.Body)
 
 	chirpyParams := database.CreateChirpParams{
-		Body:   cleanedBody,
-		UserID: userID,
+		Body:      cleanedBody,
+		UserID:    userID,
+		InReplyTo: params.InReplyTo,
+		Kind:      kind,
+		RechirpOf: params.RechirpOf,
+		QuoteOf:   params.QuoteOf,
+	}
+
+	tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not start transaction", err)
+		return
 	}
+	defer tx.Rollback()
 
-	chirp, err := apiCfg.dbQueries.CreateChirp(r.Context(), chirpyParams)
+	qtx := apiCfg.dbQueries.WithTx(tx)
+
+	chirp, err := qtx.CreateChirp(r.Context(), chirpyParams)
+
+	// a concurrent request rechirped the same chirp after the check above
+	if isUniqueViolation(err) {
+		msg := "chirp was already rechirped"
+		respondWithError(w, http.StatusConflict, msg, err)
+		return
+	}
 
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "could not create chirp", err)
 		return
 	}
 
-	resp := convertChirp(chirp)
+	if err := saveChirpHashtags(r.Context(), qtx, chirp); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not save chirp hashtags", err)
+		return
+	}
 
-	respondWithJSON(w, http.StatusCreated, resp)
-}
+	if err := saveChirpMentions(r.Context(), qtx, chirp); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not save chirp mentions", err)
+		return
+	}
 
-func (apiCfg *apiConfig) hanlderDeleteChirp(w http.ResponseWriter, r *http.Request) {
+	if params.InReplyTo.Valid {
+		if err := notify(r.Context(), qtx, parent.UserID, userID, notificationKindReply, chirp.ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "could not create notification", err)
+			return
+		}
+	}
 
-	tok, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		msg := "token was not given in headers"
-		respondWithError(w, http.StatusUnauthorized, msg, err)
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not create chirp", err)
 		return
 	}
 
+	chirps := mapChirp([]database.Chirp{chirp})
+
+	if err := apiCfg.populateChirps(r.Context(), chirps, uuid.NullUUID{UUID: userID, Valid: true}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not get referenced chirp", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, chirps[0])
+}
+
+func (apiCfg *apiConfig) hanlderDeleteChirp(w http.ResponseWriter, r *http.Request) {
+
 	defer r.Body.Close()
 
-	userID, err := auth.ValidateJWT(tok, apiCfg.secret)
+	userID, err := apiCfg.authenticate(r, scopeChirpsWrite)
 	if err != nil {
-		msg := "token was not valid"
-		respondWithError(w, http.StatusUnauthorized, msg, err)
+		respondWithAuthError(w, err)
 		return
 	}
 
@@ -306,6 +598,8 @@ func (apiCfg *apiConfig) hanlderDeleteChirp(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// rechirps of the chirp are deleted along with it, quotes of it are kept
+	// and shown with a "chirp unavailable" placeholder instead
 	if err := apiCfg.dbQueries.DeleteChrip(r.Context(), dbChirp.ID); err != nil {
 		msg := "could not delete chrip"
 		respondWithError(w, http.StatusInternalServerError, msg, err)
@@ -318,45 +612,100 @@ func (apiCfg *apiConfig) hanlderDeleteChirp(w http.ResponseWriter, r *http.Reque
 
 func (apiCfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
 
-	authorStrID := r.URL.Query().Get("author_id")
+	query := r.URL.Query()
 
-	if authorStrID != "" {
+	var authorID uuid.NullUUID
 
-		authorID, err := uuid.Parse(authorStrID)
+	if authorStrID := query.Get("author_id"); authorStrID != "" {
+
+		id, err := uuid.Parse(authorStrID)
 		if err != nil {
 			msg := "could not parse author id"
 			respondWithError(w, http.StatusBadRequest, msg, err)
 			return
 		}
 
-		dbChirps, err := apiCfg.dbQueries.GetChripsByAuthor(r.Context(), authorID)
+		authorID = uuid.NullUUID{UUID: id, Valid: true}
+	}
 
-		if err != nil {
-			msg := "could not select all chirps for author"
-			respondWithError(w, http.StatusInternalServerError, msg, err)
+	limit := defaultChirpPageSize
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+
+		parsedLimit, err := strconv.Atoi(limitStr)
+		if err != nil || parsedLimit < 1 || parsedLimit > maxChirpPageSize {
+			msg := fmt.Sprintf("limit must be between 1 and %d", maxChirpPageSize)
+			respondWithError(w, http.StatusBadRequest, msg, err)
 			return
 		}
 
-		chirps := mapChirp(dbChirps)
+		limit = parsedLimit
+	}
 
-		respondWithJSON(w, http.StatusOK, chirps)
-		return
+	var cursorCreatedAt sql.NullTime
+	var cursorID uuid.NullUUID
 
+	if cursor := query.Get("cursor"); cursor != "" {
+
+		createdAt, id, err := decodeCursor(cursor)
+		if err != nil {
+			msg := "could not parse cursor"
+			respondWithError(w, http.StatusBadRequest, msg, err)
+			return
+		}
+
+		cursorCreatedAt = sql.NullTime{Time: createdAt, Valid: true}
+		cursorID = uuid.NullUUID{UUID: id, Valid: true}
 	}
 
-	dbChirps, err := apiCfg.dbQueries.GetChirps(r.Context())
+	var dbChirps []database.Chirp
+	var err error
+
+	// fetch one extra chirp to know whether there is a next page
+	if query.Get("sort") == "desc" {
+		dbChirps, err = apiCfg.dbQueries.ListChirpsDesc(r.Context(), database.ListChirpsDescParams{
+			AuthorID:        authorID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			RowLimit:        int32(limit + 1),
+		})
+	} else {
+		dbChirps, err = apiCfg.dbQueries.ListChirpsAsc(r.Context(), database.ListChirpsAscParams{
+			AuthorID:        authorID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			RowLimit:        int32(limit + 1),
+		})
+	}
 
 	if err != nil {
 		msg := "could not select all chirps"
 		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	var nextCursor string
+
+	if len(dbChirps) > limit {
+		dbChirps = dbChirps[:limit]
+		last := dbChirps[limit-1]
+		nextCursor = encodeCursor(last.CreatedAt, last.ID)
 	}
 
 	chirps := mapChirp(dbChirps)
 
-	sortQuery := r.URL.Query().Get("sort")
+	if err := apiCfg.populateChirps(r.Context(), chirps, apiCfg.viewerID(r)); err != nil {
+		msg := "could not get chirp details"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
 
-	if sortQuery == "desc" {
-		sort.Slice(chirps, func(i, j int) bool { return chirps[i].CreatedAt.After(chirps[j].CreatedAt) })
+	// the body stays a plain array, as it was before pagination, so the
+	// cursor goes in headers
+	if nextCursor != "" {
+		query.Set("cursor", nextCursor)
+		w.Header().Set("Next-Cursor", nextCursor)
+		w.Header().Set("Link", fmt.Sprintf("<%s?%s>; rel=\"next\"", r.URL.Path, query.Encode()))
 	}
 
 	respondWithJSON(w, http.StatusOK, chirps)
@@ -393,9 +742,15 @@ func (apiCfg *apiConfig) handlerGetChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	chirp := convertChirp(dbChrip)
+	chirps := mapChirp([]database.Chirp{dbChrip})
 
-	respondWithJSON(w, http.StatusOK, chirp)
+	if err := apiCfg.populateChirps(r.Context(), chirps, apiCfg.viewerID(r)); err != nil {
+		msg := "could not get chirp details"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chirps[0])
 }
 
 func (apiCfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
@@ -415,11 +770,18 @@ func (apiCfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !apiCfg.checkLoginThrottle(w, r, params.Email) {
+		return
+	}
+	defer apiCfg.releaseLoginThrottle(r, params.Email)
+
 	user, err := apiCfg.dbQueries.GetUserByEmail(r.Context(), params.Email)
 
+	// unknown emails count as failures too, so they look the same as wrong
+	// passwords to whoever is guessing
 	if errors.Is(err, sql.ErrNoRows) {
 		msg := "Incorrect email or password"
-		respondWithError(w, http.StatusUnauthorized, msg, err)
+		apiCfg.failLogin(w, r, params.Email, msg, err)
 		return
 	}
 
@@ -429,40 +791,78 @@ func (apiCfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ok, err := auth.CheckPasswordHash(params.Password, user.HashedPassword)
+	// users without a password fail like a wrong one, so this doesn't tell
+	// anyone which accounts have none. They are sent a reset to set one,
+	// within the same limits as asking for it
+	if !user.HashedPassword.Valid {
+		if err := apiCfg.requestPasswordReset(r, user.Email); err != nil {
+			log.Printf("Error requesting password reset: %s", err)
+		}
+	}
+
+	ok, err := auth.CheckPasswordHash(params.Password, user.HashedPassword.String)
 	if !ok || err != nil {
 		msg := "Incorrect email or password"
-		respondWithError(w, http.StatusUnauthorized, msg, err)
+		apiCfg.failLogin(w, r, params.Email, msg, err)
 		return
 	}
 
-	tok, err := auth.MakeJWT(user.ID, apiCfg.secret, time.Hour)
-	if err != nil {
-		msg := "could not create JWT"
-		respondWithError(w, http.StatusInternalServerError, msg, err)
+	apiCfg.rehashPassword(r.Context(), user, params.Password)
+
+	apiCfg.loginUser(w, r, user)
+}
+
+// loginUser finishes logging in user, whose password or other proof has been
+// checked. With two-factor authentication on, that only earns a token that
+// can be exchanged at /api/login/mfa together with a code.
+func (apiCfg *apiConfig) loginUser(w http.ResponseWriter, r *http.Request, user database.User) {
+	if user.TotpEnabledAt.Valid {
+		mfaTok, err := auth.MakeMFAToken(user.ID, apiCfg.jwtKeys, mfaTokenTTL)
+		if err != nil {
+			msg := "could not create JWT"
+			respondWithError(w, http.StatusInternalServerError, msg, err)
+			return
+		}
+
+		type response struct {
+			MFARequired bool   `json:"mfa_required"`
+			MFAToken    string `json:"mfa_token"`
+		}
+
+		respondWithJSON(w, http.StatusOK, response{MFARequired: true, MFAToken: mfaTok})
+		return
 	}
 
-	refreshTok, _ := auth.MakeRefreshToken()
+	apiCfg.completeLogin(w, r, user)
+}
 
-	expirationDate := time.Now().AddDate(0, 0, expirationDays)
+// completeLogin responds with a new access token and refresh token for user.
+func (apiCfg *apiConfig) completeLogin(w http.ResponseWriter, r *http.Request, user database.User) {
+	// only the account is forgiven; failures from this address still count
+	if err := apiCfg.accountLimiter.Reset(r.Context(), accountLoginKey(user.Email)); err != nil {
+		msg := "could not reset login attempts"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
 
-	refreshTokenParams := database.CreateRefreshTokenParams{Token: refreshTok, UserID: user.ID, ExpiresAt: expirationDate, RevokedAt: sql.NullTime{}}
+	tok, err := auth.MakeJWT(user.ID, apiCfg.jwtKeys, time.Hour)
+	if err != nil {
+		msg := "could not create JWT"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
 
-	dbRefreshToken, err := apiCfg.dbQueries.CreateRefreshToken(r.Context(), refreshTokenParams)
+	// each login starts a new refresh token family
+	refreshTok, err := issueRefreshToken(r, apiCfg.dbQueries, user.ID, uuid.New())
 	if err != nil {
 		msg := "Could not create refresh token"
 		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
 	}
 
-	resp := User{
-		ID:           user.ID,
-		CreatedAt:    user.CreatedAt,
-		UpdatedAt:    user.UpdatedAt,
-		Email:        user.Email,
-		Red:          user.IsChirpyRed,
-		Token:        tok,
-		RefreshToken: dbRefreshToken.Token,
-	}
+	resp := convertUser(user)
+	resp.Token = tok
+	resp.RefreshToken = refreshTok
 
 	respondWithJSON(w, http.StatusOK, resp)
 }
@@ -476,7 +876,17 @@ func (apiCfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	dbRefreshTok, err := apiCfg.dbQueries.GetRefreshToken(r.Context(), refreshTok)
+	tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		msg := "could not start transaction"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := apiCfg.dbQueries.WithTx(tx)
+
+	dbRefreshTok, err := qtx.GetRefreshToken(r.Context(), auth.HashToken(refreshTok))
 
 	if errors.Is(err, sql.ErrNoRows) {
 		msg := "refresh token does not exist"
@@ -490,27 +900,63 @@ func (apiCfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// a token that was already rotated should never be seen again, so
+	// whoever sent it may have stolen it. Revoke the whole family, which
+	// logs out both the thief and the real user.
+	if dbRefreshTok.ReplacedBy.Valid {
+		rejectReusedRefreshToken(w, r, qtx, tx, dbRefreshTok.FamilyID)
+		return
+	}
+
 	if dbRefreshTok.RevokedAt.Valid {
+		msg := "refresh token is revoked"
+		respondWithError(w, http.StatusUnauthorized, msg, nil)
+		return
+	}
+
+	if time.Now().After(dbRefreshTok.ExpiresAt) {
 		msg := "refresh token is expired"
-		respondWithError(w, http.StatusUnauthorized, msg, err)
+		respondWithError(w, http.StatusUnauthorized, msg, nil)
+		return
+	}
+
+	newRefreshTok, err := issueRefreshToken(r, qtx, dbRefreshTok.UserID, dbRefreshTok.FamilyID)
+	if err != nil {
+		msg := "Could not create refresh token"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
 		return
 	}
 
-	user, err := apiCfg.dbQueries.GetUserByRefreshToken(r.Context(), dbRefreshTok.Token)
+	rotated, err := qtx.RotateRefreshToken(r.Context(), database.RotateRefreshTokenParams{
+		TokenHash:  dbRefreshTok.TokenHash,
+		ReplacedBy: sql.NullString{String: auth.HashToken(newRefreshTok), Valid: true},
+	})
 	if err != nil {
-		msg := "couldn't get user by refresh token"
+		msg := "Couldn't rotate refresh token"
 		respondWithError(w, http.StatusInternalServerError, msg, err)
 		return
 	}
 
-	tok, err := auth.MakeJWT(user.ID, apiCfg.secret, time.Hour)
+	// another request rotated the same token first
+	if rotated == 0 {
+		rejectReusedRefreshToken(w, r, qtx, tx, dbRefreshTok.FamilyID)
+		return
+	}
+
+	tok, err := auth.MakeJWT(dbRefreshTok.UserID, apiCfg.jwtKeys, time.Hour)
 	if err != nil {
 		msg := "could not create JWT"
 		respondWithError(w, http.StatusInternalServerError, msg, err)
 		return
 	}
 
-	resp := JWT{Token: tok}
+	if err := tx.Commit(); err != nil {
+		msg := "Couldn't rotate refresh token"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	resp := JWT{Token: tok, RefreshToken: newRefreshTok}
 
 	respondWithJSON(w, http.StatusOK, resp)
 
@@ -525,7 +971,7 @@ func (apiCfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dbRefreshTok, err := apiCfg.dbQueries.GetRefreshToken(r.Context(), refreshTok)
+	dbRefreshTok, err := apiCfg.dbQueries.GetRefreshToken(r.Context(), auth.HashToken(refreshTok))
 
 	if errors.Is(err, sql.ErrNoRows) {
 		msg := "refresh token does not exist"
@@ -544,7 +990,7 @@ func (apiCfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = apiCfg.dbQueries.UpdateRefreshToken(r.Context(), dbRefreshTok.Token)
+	err = apiCfg.dbQueries.UpdateRefreshToken(r.Context(), dbRefreshTok.TokenHash)
 	if err != nil {
 		msg := "Couldn't update refresh token"
 		respondWithError(w, http.StatusInternalServerError, msg, err)
@@ -618,22 +1064,65 @@ func main() {
 	dbURL := os.Getenv("DB_URL")
 	secret := os.Getenv("Secret")
 	polkaKey := os.Getenv("POLKA_KEY")
+	smtpAddr := os.Getenv("SMTP_ADDR")
+	adminKey := os.Getenv("ADMIN_KEY")
 	db, err := sql.Open("postgres", dbURL)
 
 	if err != nil {
 		log.Fatal("failed to open data base")
 	}
 
+	jwtKeys, err := loadKeyring(secret, os.Getenv("JWT_SIGNING_KEY_FILE"), os.Getenv("JWT_VERIFICATION_KEY_FILES"))
+	if err != nil {
+		log.Fatalf("failed to load JWT keys: %s", err)
+	}
+
+	passwordParams, err := loadPasswordParams()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	passwordPolicy, err := loadPasswordPolicy()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	oidcProvider, err := loadOIDCProvider(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	queries := database.New(db)
 
+	accountLimiter, ipLimiter, resetLimiter, err := newLoginLimiters(os.Getenv("LOGIN_LIMITER"), queries)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	const filepathRoot = "."
 	const port = "8080"
 
+	// without an SMTP server emails go to an outbox, written to
+	// MAIL_OUTBOX_DIR when it is set
+	var mail mailer.Mailer = mailer.NewOutbox(os.Getenv("MAIL_OUTBOX_DIR"))
+	if smtpAddr != "" {
+		mail = mailer.NewSMTPMailer(smtpAddr, os.Getenv("SMTP_FROM"), os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+	}
+
 	var apiCfg = apiConfig{
-		dbQueries: queries,
-		platform:  platform,
-		secret:    secret,
-		polkaKey:  polkaKey,
+		db:             db,
+		dbQueries:      queries,
+		platform:       platform,
+		jwtKeys:        jwtKeys,
+		polkaKey:       polkaKey,
+		mailer:         mail,
+		adminKey:       adminKey,
+		accountLimiter: accountLimiter,
+		ipLimiter:      ipLimiter,
+		resetLimiter:   resetLimiter,
+		passwordParams: passwordParams,
+		passwordPolicy: passwordPolicy,
+		oidc:           oidcProvider,
 	}
 
 	mux := http.NewServeMux()
@@ -642,17 +1131,63 @@ func main() {
 
 	mux.Handle("/app/", apiCfg.middlewareMetricsInc(handlerFile))
 	mux.HandleFunc("GET /api/healthz", handlerReadiness)
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.handlerJWKS)
 	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerMetric)
 	mux.HandleFunc("POST /admin/reset", apiCfg.handlerReset)
+	mux.HandleFunc("POST /admin/users/{userID}/unlock", apiCfg.handlerUnlockUser)
 	mux.HandleFunc("GET /api/chirps", apiCfg.handlerGetChirps)
+	mux.HandleFunc("GET /api/chirps/search", apiCfg.handlerSearchChirps)
 	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handlerGetChirp)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", apiCfg.handlerGetThread)
 	mux.HandleFunc("POST /api/chirps", apiCfg.handlerValidateChirp)
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", apiCfg.handlerUpdateChirp)
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.hanlderDeleteChirp)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/revisions", apiCfg.handlerGetChirpRevisions)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/like", apiCfg.handlerLikeChirp)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/like", apiCfg.handlerUnlikeChirp)
 	mux.HandleFunc("POST /api/users", apiCfg.handerUser)
 	mux.HandleFunc("POST /api/login", apiCfg.handlerLogin)
+	mux.HandleFunc("POST /api/login/mfa", apiCfg.handlerLoginMFA)
+	mux.HandleFunc("GET /api/login/oidc", apiCfg.handlerOIDCLogin)
+	mux.HandleFunc("GET /api/login/oidc/callback", apiCfg.handlerOIDCCallback)
 	mux.HandleFunc("POST /api/refresh", apiCfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevoke)
-	mux.HandleFunc("PUT /api/users", apiCfg.handlerUpdateUser)
+	mux.HandleFunc("GET /api/sessions", apiCfg.handlerGetSessions)
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", apiCfg.handlerRevokeSession)
+	mux.HandleFunc("POST /api/sessions/revoke-all", apiCfg.handlerRevokeAllSessions)
+	mux.HandleFunc("POST /api/tokens", apiCfg.handlerCreateToken)
+	mux.HandleFunc("GET /api/tokens", apiCfg.handlerGetTokens)
+	mux.HandleFunc("DELETE /api/tokens/{tokenID}", apiCfg.handlerRevokeToken)
+	mux.HandleFunc("POST /api/oauth/clients", apiCfg.handlerCreateOAuthClient)
+	mux.HandleFunc("GET /api/oauth/clients", apiCfg.handlerGetOAuthClients)
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", apiCfg.handlerDeleteOAuthClient)
+	mux.HandleFunc("GET /oauth/authorize", apiCfg.handlerAuthorize)
+	mux.HandleFunc("POST /oauth/authorize", apiCfg.handlerAuthorizeDecision)
+	mux.HandleFunc("POST /oauth/token", apiCfg.handlerOAuthToken)
+	mux.HandleFunc("POST /oauth/revoke", apiCfg.handlerOAuthRevoke)
+	mux.HandleFunc("POST /oauth/introspect", apiCfg.handlerOAuthIntrospect)
+	mux.HandleFunc("POST /api/2fa/enroll", apiCfg.handlerEnrollTOTP)
+	mux.HandleFunc("POST /api/2fa/confirm", apiCfg.handlerConfirmTOTP)
+	mux.HandleFunc("POST /api/2fa/recovery-codes", apiCfg.handlerRegenerateRecoveryCodes)
+	mux.HandleFunc("POST /api/2fa/disable", apiCfg.handlerDisableTOTP)
+	mux.HandleFunc("POST /api/password/forgot", apiCfg.handlerForgotPassword)
+	mux.HandleFunc("POST /api/password/reset", apiCfg.handlerResetPassword)
+	mux.HandleFunc("PATCH /api/users", apiCfg.handlerUpdateUser)
+	mux.HandleFunc("POST /api/users/verify", apiCfg.handlerVerifyEmail)
+	mux.HandleFunc("POST /api/users/verify/resend", apiCfg.handlerResendVerification)
+	mux.HandleFunc("GET /api/users/{handleOrID}", apiCfg.handlerGetProfile)
+	mux.HandleFunc("DELETE /api/users/me", apiCfg.handlerDeleteAccount)
+	mux.HandleFunc("GET /api/users/me/export", apiCfg.handlerExportAccount)
+	mux.HandleFunc("POST /api/users/{userID}/follow", apiCfg.handlerFollow)
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", apiCfg.handlerUnfollow)
+	mux.HandleFunc("GET /api/users/{userID}/followers", apiCfg.handlerGetFollowers)
+	mux.HandleFunc("GET /api/users/{userID}/following", apiCfg.handlerGetFollowing)
+	mux.HandleFunc("GET /api/users/{userID}/likes", apiCfg.handlerGetUserLikes)
+	mux.HandleFunc("GET /api/timeline", apiCfg.handlerTimeline)
+	mux.HandleFunc("GET /api/notifications", apiCfg.handlerGetNotifications)
+	mux.HandleFunc("POST /api/notifications/read", apiCfg.handlerReadNotifications)
+	mux.HandleFunc("GET /api/hashtags/trending", apiCfg.handlerGetTrendingHashtags)
+	mux.HandleFunc("GET /api/hashtags/{tag}/chirps", apiCfg.handlerGetHashtagChirps)
 	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerPolkaWebhook)
 	srv := &http.Server{
 		Addr:    ":" + port,
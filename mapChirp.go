@@ -11,6 +11,9 @@ func mapChirp(dbChirps []database.Chirp) []Chirp {
 	return chirps
 }
 
+// convertChirp maps a chirps row to the API type. Chirps are only ever
+// updated by editing their body, so a chirp whose updated_at moved past its
+// created_at has been edited.
 func convertChirp(dbChirp database.Chirp) Chirp {
 	return Chirp{
 		ID:        dbChirp.ID,
@@ -18,5 +21,10 @@ func convertChirp(dbChirp database.Chirp) Chirp {
 		UpdatedAt: dbChirp.UpdatedAt,
 		Body:      dbChirp.Body,
 		UserID:    dbChirp.UserID,
+		InReplyTo: dbChirp.InReplyTo,
+		Kind:      dbChirp.Kind,
+		RechirpOf: dbChirp.RechirpOf,
+		QuoteOf:   dbChirp.QuoteOf,
+		Edited:    dbChirp.UpdatedAt.After(dbChirp.CreatedAt),
 	}
 }
@@ -11,6 +11,7 @@ import (
 func TestMapChirp(t *testing.T) {
 	var dbChripTime1 = time.Date(2025, time.April, 10, 20, 0, 0, 0, time.UTC)
 	var dbChripTime2 = time.Date(2025, time.November, 10, 20, 0, 0, 0, time.UTC)
+	var dbChripTime3 = time.Date(2025, time.November, 11, 20, 0, 0, 0, time.UTC)
 	var dbChripId1 = uuid.New()
 	var dbChirpId2 = uuid.New()
 	var dbChripUserId1 = uuid.New()
@@ -53,6 +54,27 @@ func TestMapChirp(t *testing.T) {
 				},
 			},
 		},
+		{
+			input: []database.Chirp{
+				{
+					ID:        dbChripId1,
+					CreatedAt: dbChripTime2,
+					UpdatedAt: dbChripTime3,
+					Body:      "hello again",
+					UserID:    dbChripUserId1,
+				},
+			},
+			expected: []Chirp{
+				{
+					ID:        dbChripId1,
+					CreatedAt: dbChripTime2,
+					UpdatedAt: dbChripTime3,
+					Body:      "hello again",
+					UserID:    dbChripUserId1,
+					Edited:    true,
+				},
+			},
+		},
 	}
 
 	for _, c := range cases {
@@ -0,0 +1,21 @@
+package main
+
+import "github.com/7minutech/chirpy/internal/database"
+
+// convertUser maps a users row to the API type returned to that user. It
+// leaves out the password hash; tokens are filled in by the caller.
+func convertUser(dbUser database.User) User {
+	return User{
+		ID:            dbUser.ID,
+		CreatedAt:     dbUser.CreatedAt,
+		UpdatedAt:     dbUser.UpdatedAt,
+		Email:         dbUser.Email,
+		EmailVerified: dbUser.EmailVerifiedAt.Valid,
+		Handle:        dbUser.Handle.String,
+		DisplayName:   dbUser.DisplayName,
+		Bio:           dbUser.Bio,
+		Location:      dbUser.Location,
+		TwoFactor:     dbUser.TotpEnabledAt.Valid,
+		Red:           dbUser.IsChirpyRed,
+	}
+}
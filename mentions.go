@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// uniqueViolation is the postgres error code for a unique constraint failing
+const uniqueViolation = "23505"
+
+var handlePattern = regexp.MustCompile(`^[a-zA-Z0-9_]{3,30}$`)
+
+// a mention has to start the body or follow a character that can't be part
+// of a handle, so email addresses are not mentions
+var mentionPattern = regexp.MustCompile(`(?:^|[^a-zA-Z0-9_@])@([a-zA-Z0-9_]{3,30})\b`)
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
+// extractMentions returns the distinct lowercased handles mentioned in body,
+// without the leading '@', in the order they first appear.
+func extractMentions(body string) []string {
+	seen := make(map[string]struct{})
+	var handles []string
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		handle := strings.ToLower(match[1])
+		if _, ok := seen[handle]; ok {
+			continue
+		}
+		seen[handle] = struct{}{}
+		handles = append(handles, handle)
+	}
+
+	return handles
+}
+
+// saveChirpMentions replaces the users mentioned by chirp with the ones in
+// its body and notifies users who were not mentioned by it before. Pass
+// queries bound to the transaction that stored the chirp.
+func saveChirpMentions(ctx context.Context, queries *database.Queries, chirp database.Chirp) error {
+	previousIDs, err := queries.GetChirpMentions(ctx, chirp.ID)
+	if err != nil {
+		return err
+	}
+
+	previouslyMentioned := make(map[uuid.UUID]bool, len(previousIDs))
+	for _, id := range previousIDs {
+		previouslyMentioned[id] = true
+	}
+
+	if err := queries.DeleteChirpMentions(ctx, chirp.ID); err != nil {
+		return err
+	}
+
+	handles := extractMentions(chirp.Body)
+	if len(handles) == 0 {
+		return nil
+	}
+
+	users, err := queries.GetUsersByHandles(ctx, handles)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if user.ID == chirp.UserID {
+			continue
+		}
+
+		mentionParams := database.AddChirpMentionParams{
+			ChirpID: chirp.ID,
+			UserID:  user.ID,
+		}
+
+		if err := queries.AddChirpMention(ctx, mentionParams); err != nil {
+			return err
+		}
+
+		if previouslyMentioned[user.ID] {
+			continue
+		}
+
+		if err := notify(ctx, queries, user.ID, chirp.UserID, notificationKindMention, chirp.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"slices"
+	"testing"
+
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestExtractMentions(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			input:    "I had something interesting for breakfast",
+			expected: nil,
+		},
+		{
+			input:    "@alice and @Bob_99 should see this",
+			expected: []string{"alice", "bob_99"},
+		},
+		{
+			input:    "hey @alice, @ALICE! (@carol)",
+			expected: []string{"alice", "carol"},
+		},
+		{
+			input:    "mail me at dave@example.com or @@eve, @al is too short",
+			expected: nil,
+		},
+	}
+
+	for _, c := range cases {
+		actual := extractMentions(c.input)
+		if !slices.Equal(actual, c.expected) {
+			t.Errorf("extractMentions(%s) == %v, expected: %v", c.input, actual, c.expected)
+		}
+	}
+}
+
+func TestSaveChirpMentionsNotifiesMentionedUsers(t *testing.T) {
+	fake, db := newFakeDB(t)
+
+	authorID, bobID := uuid.New(), uuid.New()
+
+	fake.answer("GetUsersByHandles", func(args []driver.Value) ([]map[string]any, error) {
+		return []map[string]any{
+			{"id": bobID, "handle": "bob"},
+			{"id": authorID, "handle": "me"},
+		}, nil
+	})
+
+	chirp := database.Chirp{ID: uuid.New(), UserID: authorID, Body: "hey @bob, @me and @nobody"}
+
+	if err := saveChirpMentions(context.Background(), database.New(db), chirp); err != nil {
+		t.Fatalf("saveChirpMentions err = %v", err)
+	}
+
+	mentions := fake.callsTo("AddChirpMention")
+	if len(mentions) != 1 || mentions[0][1] != bobID.String() {
+		t.Fatalf("mentions saved = %v, expected only bob", mentions)
+	}
+
+	notifications := fake.callsTo("CreateNotification")
+	if len(notifications) != 1 {
+		t.Fatalf("notifications created = %v, expected one for bob", notifications)
+	}
+
+	if userID, actorID, kind := notifications[0][0], notifications[0][1], notifications[0][2]; userID != bobID.String() ||
+		actorID != authorID.String() || kind != notificationKindMention {
+		t.Fatalf("notification = %v, expected a mention of bob by the author", notifications[0])
+	}
+}
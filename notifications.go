@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	notificationKindMention = "mention"
+	notificationKindReply   = "reply"
+	notificationKindLike    = "like"
+)
+
+type Notification struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	Kind      string     `json:"kind"`
+	ActorID   uuid.UUID  `json:"actor_id"`
+	ChirpID   uuid.UUID  `json:"chirp_id"`
+	ReadAt    *time.Time `json:"read_at"`
+}
+
+// notify tells userID that actorID did something of kind to chirpID. Users
+// are never notified about their own actions.
+func notify(ctx context.Context, queries *database.Queries, userID, actorID uuid.UUID, kind string, chirpID uuid.UUID) error {
+	if userID == actorID {
+		return nil
+	}
+
+	return queries.CreateNotification(ctx, database.CreateNotificationParams{
+		UserID:  userID,
+		ActorID: actorID,
+		Kind:    kind,
+		ChirpID: chirpID,
+	})
+}
+
+func (apiCfg *apiConfig) handlerGetNotifications(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := apiCfg.authenticate(r, scopeChirpsRead)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	notificationParams := database.GetNotificationsParams{
+		UserID:     userID,
+		UnreadOnly: r.URL.Query().Get("unread") == "true",
+		RowLimit:   defaultChirpPageSize,
+	}
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxChirpPageSize {
+			msg := fmt.Sprintf("limit must be between 1 and %d", maxChirpPageSize)
+			respondWithError(w, http.StatusBadRequest, msg, err)
+			return
+		}
+
+		notificationParams.RowLimit = int32(limit)
+	}
+
+	dbNotifications, err := apiCfg.dbQueries.GetNotifications(r.Context(), notificationParams)
+	if err != nil {
+		msg := "could not get notifications"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	notifications := make([]Notification, len(dbNotifications))
+	for i, dbNotification := range dbNotifications {
+		notifications[i] = Notification{
+			ID:        dbNotification.ID,
+			CreatedAt: dbNotification.CreatedAt,
+			Kind:      dbNotification.Kind,
+			ActorID:   dbNotification.ActorID,
+			ChirpID:   dbNotification.ChirpID,
+		}
+		if dbNotification.ReadAt.Valid {
+			notifications[i].ReadAt = &dbNotification.ReadAt.Time
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, notifications)
+}
+
+func (apiCfg *apiConfig) handlerReadNotifications(w http.ResponseWriter, r *http.Request) {
+
+	defer r.Body.Close()
+
+	userID, err := apiCfg.authenticate(r, scopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	type parameters struct {
+		IDs []uuid.UUID `json:"ids"`
+	}
+
+	var params parameters
+
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			msg := "could not decode request body"
+			respondWithError(w, http.StatusBadRequest, msg, err)
+			return
+		}
+	}
+
+	if len(params.IDs) == 0 {
+		err = apiCfg.dbQueries.MarkAllNotificationsRead(r.Context(), userID)
+	} else {
+		err = apiCfg.dbQueries.MarkNotificationsRead(r.Context(), database.MarkNotificationsReadParams{
+			UserID: userID,
+			Ids:    params.IDs,
+		})
+	}
+
+	if err != nil {
+		msg := "could not mark notifications as read"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/7minutech/chirpy/internal/auth"
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const authorizationCodeTTL = 10 * time.Minute
+
+// scopeDescriptions are shown on the consent screen.
+var scopeDescriptions = map[string]string{
+	scopeChirpsRead:   "Read chirps and your timeline",
+	scopeChirpsWrite:  "Post, edit, delete and like chirps as you",
+	scopeProfileWrite: "Change your profile",
+	scopeFollowsWrite: "Follow and unfollow users as you",
+}
+
+// oauthError is an error as RFC 6749 describes it, sent as JSON from the
+// token endpoints and as query parameters to a client's redirect URI.
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// authorizeRequest is a checked request from a client for a user's consent.
+type authorizeRequest struct {
+	client        database.OauthClient
+	redirectURI   string
+	scopes        []string
+	state         string
+	codeChallenge string
+}
+
+// parseAuthorizeRequest checks the parameters of an authorization request.
+// Until the client and redirect URI are known to match, an error leaves
+// req.redirectURI empty; it has to be shown to the user rather than sent to
+// a URI that may belong to someone else.
+func (apiCfg *apiConfig) parseAuthorizeRequest(ctx context.Context, values url.Values) (authorizeRequest, *oauthError, error) {
+	var req authorizeRequest
+
+	clientID, err := uuid.Parse(values.Get("client_id"))
+	if err != nil {
+		return req, &oauthError{Code: "invalid_request", Description: "client_id is missing or malformed"}, nil
+	}
+
+	req.client, err = apiCfg.dbQueries.GetOAuthClient(ctx, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return req, &oauthError{Code: "invalid_client", Description: "client does not exist"}, nil
+	}
+
+	if err != nil {
+		return req, nil, err
+	}
+
+	redirectURI := values.Get("redirect_uri")
+	if !slices.Contains(req.client.RedirectUris, redirectURI) {
+		return req, &oauthError{Code: "invalid_request", Description: "redirect_uri is not registered for this client"}, nil
+	}
+
+	req.redirectURI = redirectURI
+	req.state = values.Get("state")
+
+	if values.Get("response_type") != "code" {
+		return req, &oauthError{Code: "unsupported_response_type", Description: "response_type must be code"}, nil
+	}
+
+	// PKCE is required of every client, confidential or not
+	if values.Get("code_challenge_method") != "S256" || !auth.ValidPKCEValue(values.Get("code_challenge")) {
+		return req, &oauthError{Code: "invalid_request", Description: "code_challenge is required, with code_challenge_method S256"}, nil
+	}
+
+	req.codeChallenge = values.Get("code_challenge")
+
+	scopes := strings.Fields(values.Get("scope"))
+	if len(scopes) == 0 {
+		scopes = req.client.Scopes
+	}
+
+	for _, scope := range scopes {
+		if !slices.Contains(req.client.Scopes, scope) {
+			return req, &oauthError{Code: "invalid_scope", Description: "scope " + scope + " is not allowed for this client"}, nil
+		}
+	}
+
+	req.scopes, err = validateScopes(scopes)
+	if err != nil {
+		return req, &oauthError{Code: "invalid_scope", Description: err.Error()}, nil
+	}
+
+	return req, nil, nil
+}
+
+// redirectToClient sends the user back to the client with params, and state
+// when the client gave one.
+func redirectToClient(w http.ResponseWriter, r *http.Request, req authorizeRequest, params url.Values) {
+	u, err := url.Parse(req.redirectURI)
+	if err != nil {
+		msg := "could not parse redirect uri"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if req.state != "" {
+		params.Set("state", req.state)
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func redirectWithOAuthError(w http.ResponseWriter, r *http.Request, req authorizeRequest, oerr *oauthError) {
+	params := url.Values{"error": {oerr.Code}}
+	if oerr.Description != "" {
+		params.Set("error_description", oerr.Description)
+	}
+	redirectToClient(w, r, req, params)
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Authorize {{.ClientName}}</title></head>
+<body>
+{{if .Fatal}}
+<h1>Authorization failed</h1>
+<p>{{.Error}}</p>
+{{else}}
+<h1>{{.ClientName}} wants to use your Chirpy account</h1>
+<p>It will be able to:</p>
+<ul>
+{{range .Scopes}}<li>{{.}}</li>
+{{end}}</ul>
+{{if .Error}}<p><strong>{{.Error}}</strong></p>{{end}}
+<form method="post" action="/oauth/authorize">
+{{range $name, $value := .Hidden}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<p><label>Email <input type="email" name="email" value="{{.Email}}" required></label></p>
+<p><label>Password <input type="password" name="password" required></label></p>
+<p><label>Two-factor or recovery code, if enabled <input type="text" name="code" autocomplete="one-time-code"></label></p>
+<p><button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny" formnovalidate>Deny</button></p>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+type consentPage struct {
+	ClientName string
+	Scopes     []string
+	Hidden     map[string]string
+	Email      string
+	Error      string
+	// Fatal pages explain a broken request and have no form
+	Fatal bool
+}
+
+// renderConsent writes the consent screen. The page asks for a password, so
+// it must never be framed by another site.
+func renderConsent(w http.ResponseWriter, code int, page consentPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+
+	if err := consentTemplate.Execute(w, page); err != nil {
+		log.Printf("Error rendering consent page: %s", err)
+	}
+}
+
+func renderAuthorizeError(w http.ResponseWriter, code int, msg string) {
+	renderConsent(w, code, consentPage{Error: msg, Fatal: true})
+}
+
+func newConsentPage(req authorizeRequest) consentPage {
+	scopes := make([]string, len(req.scopes))
+	for i, scope := range req.scopes {
+		scopes[i] = scopeDescriptions[scope]
+	}
+
+	return consentPage{
+		ClientName: req.client.Name,
+		Scopes:     scopes,
+		Hidden: map[string]string{
+			"response_type":         "code",
+			"client_id":             req.client.ID.String(),
+			"redirect_uri":          req.redirectURI,
+			"scope":                 strings.Join(req.scopes, " "),
+			"state":                 req.state,
+			"code_challenge":        req.codeChallenge,
+			"code_challenge_method": "S256",
+		},
+	}
+}
+
+// handlerAuthorize shows the consent screen for an authorization request.
+func (apiCfg *apiConfig) handlerAuthorize(w http.ResponseWriter, r *http.Request) {
+
+	req, oerr, err := apiCfg.parseAuthorizeRequest(r.Context(), r.URL.Query())
+	if err != nil {
+		log.Printf("Error checking authorization request: %s", err)
+		renderAuthorizeError(w, http.StatusInternalServerError, "could not check the authorization request")
+		return
+	}
+
+	if oerr != nil && req.redirectURI == "" {
+		renderAuthorizeError(w, http.StatusBadRequest, oerr.Description)
+		return
+	}
+
+	if oerr != nil {
+		redirectWithOAuthError(w, r, req, oerr)
+		return
+	}
+
+	renderConsent(w, http.StatusOK, newConsentPage(req))
+}
+
+// handlerAuthorizeDecision handles the consent form. Allowing needs the
+// user's password, and second factor when they have one, since there is no
+// browser session to rely on. Failures count towards the login lockout.
+func (apiCfg *apiConfig) handlerAuthorizeDecision(w http.ResponseWriter, r *http.Request) {
+
+	defer r.Body.Close()
+
+	if err := r.ParseForm(); err != nil {
+		renderAuthorizeError(w, http.StatusBadRequest, "could not parse form")
+		return
+	}
+
+	req, oerr, err := apiCfg.parseAuthorizeRequest(r.Context(), r.PostForm)
+	if err != nil {
+		log.Printf("Error checking authorization request: %s", err)
+		renderAuthorizeError(w, http.StatusInternalServerError, "could not check the authorization request")
+		return
+	}
+
+	if oerr != nil && req.redirectURI == "" {
+		renderAuthorizeError(w, http.StatusBadRequest, oerr.Description)
+		return
+	}
+
+	if oerr != nil {
+		redirectWithOAuthError(w, r, req, oerr)
+		return
+	}
+
+	if r.PostForm.Get("decision") != "allow" {
+		redirectWithOAuthError(w, r, req, &oauthError{Code: "access_denied", Description: "the user denied access"})
+		return
+	}
+
+	email := r.PostForm.Get("email")
+
+	page := newConsentPage(req)
+	page.Email = email
+
+	refusal, err := apiCfg.loginThrottle(r, email)
+	if err != nil {
+		log.Printf("Error checking login attempts: %s", err)
+		renderAuthorizeError(w, http.StatusInternalServerError, "could not check login attempts")
+		return
+	}
+
+	if refusal != nil {
+		setRetryAfter(w, refusal.wait)
+		page.Error = refusal.msg
+		renderConsent(w, refusal.code, page)
+		return
+	}
+	defer apiCfg.releaseLoginThrottle(r, email)
+
+	user, ok, err := apiCfg.checkConsentLogin(r.Context(), email, r.PostForm.Get("password"), r.PostForm.Get("code"))
+	if err != nil {
+		log.Printf("Error checking login: %s", err)
+		renderAuthorizeError(w, http.StatusInternalServerError, "could not check login")
+		return
+	}
+
+	if !ok {
+		wait, err := apiCfg.recordLoginFailure(r, email)
+		if err != nil {
+			log.Printf("Error recording login attempt: %s", err)
+			renderAuthorizeError(w, http.StatusInternalServerError, "could not record login attempt")
+			return
+		}
+
+		if wait > 0 {
+			setRetryAfter(w, wait)
+		}
+
+		page.Error = "Incorrect email, password or code"
+		renderConsent(w, http.StatusUnauthorized, page)
+		return
+	}
+
+	if err := apiCfg.accountLimiter.Reset(r.Context(), accountLoginKey(user.Email)); err != nil {
+		log.Printf("Error resetting login attempts: %s", err)
+		renderAuthorizeError(w, http.StatusInternalServerError, "could not reset login attempts")
+		return
+	}
+
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error creating authorization code: %s", err)
+		renderAuthorizeError(w, http.StatusInternalServerError, "could not create authorization code")
+		return
+	}
+
+	err = apiCfg.dbQueries.CreateOAuthAuthorizationCode(r.Context(), database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      req.client.ID,
+		UserID:        user.ID,
+		RedirectUri:   req.redirectURI,
+		Scopes:        req.scopes,
+		CodeChallenge: req.codeChallenge,
+		ExpiresAt:     time.Now().UTC().Add(authorizationCodeTTL),
+	})
+	if err != nil {
+		log.Printf("Error creating authorization code: %s", err)
+		renderAuthorizeError(w, http.StatusInternalServerError, "could not create authorization code")
+		return
+	}
+
+	redirectToClient(w, r, req, url.Values{"code": {code}})
+}
+
+// checkConsentLogin checks the credentials from the consent form. code is a
+// TOTP code or, when it isn't six characters, a recovery code; it is only
+// needed when the user has two-factor authentication on.
+func (apiCfg *apiConfig) checkConsentLogin(ctx context.Context, email, password, code string) (database.User, bool, error) {
+	user, err := apiCfg.dbQueries.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, false, nil
+	}
+
+	if err != nil {
+		return database.User{}, false, err
+	}
+
+	ok, err := auth.CheckPasswordHash(password, user.HashedPassword.String)
+	if !ok || err != nil {
+		return database.User{}, false, nil
+	}
+
+	apiCfg.rehashPassword(ctx, user, password)
+
+	if !user.TotpEnabledAt.Valid {
+		return user, true, nil
+	}
+
+	totpCode, recoveryCode := code, ""
+	if len(code) != 6 {
+		totpCode, recoveryCode = "", code
+	}
+
+	ok, err = apiCfg.checkSecondFactor(ctx, user, totpCode, recoveryCode)
+	if err != nil || !ok {
+		return database.User{}, false, err
+	}
+
+	return user, true, nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"github.com/7minutech/chirpy/internal/auth"
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxClientNameLength   = 50
+	maxClientRedirectURIs = 10
+	maxClientsPerUser     = 20
+)
+
+// OAuthClient is a third-party app that can ask users for access.
+// ClientSecret is only set in the response that registers a confidential
+// client; public clients, such as mobile apps, have none and rely on PKCE.
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+}
+
+func convertOAuthClient(dbClient database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:           dbClient.ID,
+		CreatedAt:    dbClient.CreatedAt,
+		Name:         dbClient.Name,
+		RedirectURIs: dbClient.RedirectUris,
+		Scopes:       dbClient.Scopes,
+		Confidential: dbClient.SecretHash.Valid,
+	}
+}
+
+// validRedirectURI accepts absolute https URIs, and http ones on the
+// loopback address for apps running on the user's machine. Fragments are
+// not allowed since the code is added to the query.
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" || u.Fragment != "" || u.User != nil {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		if host == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	default:
+		return false
+	}
+}
+
+func (apiCfg *apiConfig) handlerCreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+
+	defer r.Body.Close()
+
+	userID, err := apiCfg.authenticateSession(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	type parameters struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Confidential bool     `json:"confidential"`
+	}
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		msg := "could not decode request body"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	if params.Name == "" || utf8.RuneCountInString(params.Name) > maxClientNameLength {
+		msg := fmt.Sprintf("name must be 1 to %d characters", maxClientNameLength)
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	if len(params.RedirectURIs) == 0 || len(params.RedirectURIs) > maxClientRedirectURIs {
+		msg := fmt.Sprintf("redirect_uris must have 1 to %d entries", maxClientRedirectURIs)
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	for _, uri := range params.RedirectURIs {
+		if !validRedirectURI(uri) {
+			msg := fmt.Sprintf("redirect uri %q must be https, or http on localhost, without a fragment", uri)
+			respondWithError(w, http.StatusBadRequest, msg, nil)
+			return
+		}
+	}
+
+	scopes, err := validateScopes(params.Scopes)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	existing, err := apiCfg.dbQueries.GetOAuthClients(r.Context(), userID)
+	if err != nil {
+		msg := "could not get clients"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if len(existing) >= maxClientsPerUser {
+		msg := fmt.Sprintf("users can have at most %d clients", maxClientsPerUser)
+		respondWithError(w, http.StatusConflict, msg, nil)
+		return
+	}
+
+	var secret string
+	var secretHash sql.NullString
+
+	if params.Confidential {
+		secret, err = auth.MakeRefreshToken()
+		if err != nil {
+			msg := "could not create client secret"
+			respondWithError(w, http.StatusInternalServerError, msg, err)
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	dbClient, err := apiCfg.dbQueries.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		UserID:       userID,
+		Name:         params.Name,
+		SecretHash:   secretHash,
+		RedirectUris: params.RedirectURIs,
+		Scopes:       scopes,
+	})
+	if err != nil {
+		msg := "could not create client"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	resp := convertOAuthClient(dbClient)
+	resp.ClientSecret = secret
+
+	respondWithJSON(w, http.StatusCreated, resp)
+}
+
+func (apiCfg *apiConfig) handlerGetOAuthClients(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := apiCfg.authenticateSession(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	dbClients, err := apiCfg.dbQueries.GetOAuthClients(r.Context(), userID)
+	if err != nil {
+		msg := "could not get clients"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	clients := make([]OAuthClient, len(dbClients))
+	for i, dbClient := range dbClients {
+		clients[i] = convertOAuthClient(dbClient)
+	}
+
+	respondWithJSON(w, http.StatusOK, clients)
+}
+
+// handlerDeleteOAuthClient removes a client along with every grant users
+// gave it, so its tokens stop working.
+func (apiCfg *apiConfig) handlerDeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := apiCfg.authenticateSession(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		msg := "could not parse client id"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	deleted, err := apiCfg.dbQueries.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID:     clientID,
+		UserID: userID,
+	})
+	if err != nil {
+		msg := "could not delete client"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if deleted == 0 {
+		msg := "client does not exist"
+		respondWithError(w, http.StatusNotFound, msg, nil)
+		return
+	}
+
+	respondWithJSON(w, http.StatusNoContent, nil)
+}
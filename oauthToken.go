@@ -0,0 +1,431 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/7minutech/chirpy/internal/auth"
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const oauthAccessTokenTTL = time.Hour
+
+func respondWithOAuthError(w http.ResponseWriter, code int, oerr oauthError, err error) {
+	if err != nil {
+		log.Println(err)
+	}
+	if code > 499 {
+		log.Printf("Responding with 5XX error: %s", oerr.Description)
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, code, oerr)
+}
+
+var errInvalidClient = errors.New("client authentication failed")
+
+// authenticateClient identifies the client calling the token endpoints.
+// Confidential clients send their secret with HTTP Basic authentication or
+// as client_secret in the form; public clients only send client_id.
+func (apiCfg *apiConfig) authenticateClient(r *http.Request) (database.OauthClient, error) {
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		// RFC 6749 has both form-encoded before they are put in the header
+		var err error
+		if clientID, err = url.QueryUnescape(clientID); err != nil {
+			return database.OauthClient{}, errInvalidClient
+		}
+		if secret, err = url.QueryUnescape(secret); err != nil {
+			return database.OauthClient{}, errInvalidClient
+		}
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	id, err := uuid.Parse(clientID)
+	if err != nil {
+		return database.OauthClient{}, errInvalidClient
+	}
+
+	client, err := apiCfg.dbQueries.GetOAuthClient(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.OauthClient{}, errInvalidClient
+	}
+
+	if err != nil {
+		return database.OauthClient{}, err
+	}
+
+	if !client.SecretHash.Valid {
+		if secret != "" {
+			return database.OauthClient{}, errInvalidClient
+		}
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+		return database.OauthClient{}, errInvalidClient
+	}
+
+	return client, nil
+}
+
+// respondWithClientError answers a failed authenticateClient.
+func respondWithClientError(w http.ResponseWriter, r *http.Request, err error) {
+	if !errors.Is(err, errInvalidClient) {
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthError{Code: "server_error", Description: "could not check client"}, err)
+		return
+	}
+
+	if _, _, basic := r.BasicAuth(); basic {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+	respondWithOAuthError(w, http.StatusUnauthorized, oauthError{Code: "invalid_client", Description: err.Error()}, nil)
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+func (apiCfg *apiConfig) respondWithOAuthTokens(w http.ResponseWriter, grant database.OauthGrant, scopes []string, refreshTok string) {
+	accessTok, err := auth.MakeOAuthJWT(grant.UserID, grant.ClientID, grant.ID, scopes, apiCfg.jwtKeys, oauthAccessTokenTTL)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthError{Code: "server_error", Description: "could not create access token"}, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, oauthTokenResponse{
+		AccessToken:  accessTok,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenTTL.Seconds()),
+		RefreshToken: refreshTok,
+		Scope:        strings.Join(scopes, " "),
+	})
+}
+
+// handlerOAuthToken exchanges an authorization code or a refresh token for
+// an access token. Refresh tokens are rotated on every use.
+func (apiCfg *apiConfig) handlerOAuthToken(w http.ResponseWriter, r *http.Request) {
+
+	defer r.Body.Close()
+
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, oauthError{Code: "invalid_request", Description: "could not parse form"}, err)
+		return
+	}
+
+	client, err := apiCfg.authenticateClient(r)
+	if err != nil {
+		respondWithClientError(w, r, err)
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		apiCfg.exchangeAuthorizationCode(w, r, client)
+	case "refresh_token":
+		apiCfg.exchangeOAuthRefreshToken(w, r, client)
+	default:
+		respondWithOAuthError(w, http.StatusBadRequest, oauthError{Code: "unsupported_grant_type", Description: "grant_type must be authorization_code or refresh_token"}, nil)
+	}
+}
+
+func (apiCfg *apiConfig) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	invalidGrant := oauthError{Code: "invalid_grant", Description: "authorization code is invalid, expired or already used"}
+
+	codeHash := auth.HashToken(r.PostForm.Get("code"))
+
+	code, err := apiCfg.dbQueries.UseOAuthAuthorizationCode(r.Context(), codeHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		// a code used twice may have been stolen, so whatever the first use
+		// got stops working too
+		if err := apiCfg.dbQueries.RevokeOAuthGrantsByCode(r.Context(), codeHash); err != nil {
+			respondWithOAuthError(w, http.StatusInternalServerError, oauthError{Code: "server_error", Description: "could not revoke grant"}, err)
+			return
+		}
+
+		respondWithOAuthError(w, http.StatusBadRequest, invalidGrant, nil)
+		return
+	}
+
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthError{Code: "server_error", Description: "could not use authorization code"}, err)
+		return
+	}
+
+	// the code is spent either way, so a wrong verifier can't be retried
+	if code.ClientID != client.ID || code.RedirectUri != r.PostForm.Get("redirect_uri") ||
+		!auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		respondWithOAuthError(w, http.StatusBadRequest, invalidGrant, nil)
+		return
+	}
+
+	refreshTok, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthError{Code: "server_error", Description: "could not create refresh token"}, err)
+		return
+	}
+
+	grant, err := apiCfg.dbQueries.CreateOAuthGrant(r.Context(), database.CreateOAuthGrantParams{
+		ClientID:         client.ID,
+		UserID:           code.UserID,
+		Scopes:           code.Scopes,
+		CodeHash:         codeHash,
+		RefreshTokenHash: auth.HashToken(refreshTok),
+		RefreshExpiresAt: time.Now().UTC().AddDate(0, 0, expirationDays),
+	})
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthError{Code: "server_error", Description: "could not create grant"}, err)
+		return
+	}
+
+	apiCfg.respondWithOAuthTokens(w, grant, grant.Scopes, refreshTok)
+}
+
+func (apiCfg *apiConfig) exchangeOAuthRefreshToken(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	invalidGrant := oauthError{Code: "invalid_grant", Description: "refresh token is invalid, expired or revoked"}
+
+	oldHash := auth.HashToken(r.PostForm.Get("refresh_token"))
+
+	grant, err := apiCfg.dbQueries.GetOAuthGrantByRefreshToken(r.Context(), oldHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		apiCfg.rejectOAuthRefreshToken(w, r, oldHash, invalidGrant)
+		return
+	}
+
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthError{Code: "server_error", Description: "could not get grant"}, err)
+		return
+	}
+
+	if grant.ClientID != client.ID {
+		respondWithOAuthError(w, http.StatusBadRequest, invalidGrant, nil)
+		return
+	}
+
+	// the client may ask for fewer scopes than it was granted, but not more
+	scopes := grant.Scopes
+	if requested := strings.Fields(r.PostForm.Get("scope")); len(requested) > 0 {
+		for _, scope := range requested {
+			if !slices.Contains(grant.Scopes, scope) {
+				respondWithOAuthError(w, http.StatusBadRequest, oauthError{Code: "invalid_scope", Description: "scope " + scope + " was not granted"}, nil)
+				return
+			}
+		}
+
+		scopes, _ = validateScopes(requested)
+	}
+
+	refreshTok, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthError{Code: "server_error", Description: "could not create refresh token"}, err)
+		return
+	}
+
+	tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthError{Code: "server_error", Description: "could not start transaction"}, err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := apiCfg.dbQueries.WithTx(tx)
+
+	rotated, err := qtx.RotateOAuthRefreshToken(r.Context(), database.RotateOAuthRefreshTokenParams{
+		NewHash:          auth.HashToken(refreshTok),
+		RefreshExpiresAt: time.Now().UTC().AddDate(0, 0, expirationDays),
+		ID:               grant.ID,
+		OldHash:          oldHash,
+	})
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthError{Code: "server_error", Description: "could not rotate refresh token"}, err)
+		return
+	}
+
+	// another request rotated the same token first, so it was used twice
+	if rotated == 0 {
+		tx.Rollback()
+		apiCfg.rejectOAuthRefreshToken(w, r, oldHash, invalidGrant)
+		return
+	}
+
+	err = qtx.RetireOAuthRefreshToken(r.Context(), database.RetireOAuthRefreshTokenParams{
+		TokenHash: oldHash,
+		GrantID:   grant.ID,
+	})
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthError{Code: "server_error", Description: "could not rotate refresh token"}, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthError{Code: "server_error", Description: "could not rotate refresh token"}, err)
+		return
+	}
+
+	apiCfg.respondWithOAuthTokens(w, grant, scopes, refreshTok)
+}
+
+// rejectOAuthRefreshToken responds with oerr to a refresh token that isn't
+// the current one of an active grant. If it is one its grant rotated away
+// from, the token was copied and used by someone else as well, so the grant
+// is revoked and both lose access.
+func (apiCfg *apiConfig) rejectOAuthRefreshToken(w http.ResponseWriter, r *http.Request, tokenHash string, oerr oauthError) {
+	retired, err := apiCfg.dbQueries.GetRetiredOAuthRefreshToken(r.Context(), tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithOAuthError(w, http.StatusBadRequest, oerr, nil)
+		return
+	}
+
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthError{Code: "server_error", Description: "could not get grant"}, err)
+		return
+	}
+
+	if err := apiCfg.dbQueries.RevokeOAuthGrant(r.Context(), retired.GrantID); err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthError{Code: "server_error", Description: "could not revoke grant"}, err)
+		return
+	}
+
+	respondWithOAuthError(w, http.StatusBadRequest, oerr, nil)
+}
+
+// clientGrant finds the active grant tok belongs to, if it is an access or
+// refresh token issued to client. The claims are only set for access tokens.
+func (apiCfg *apiConfig) clientGrant(r *http.Request, client database.OauthClient, tok string) (database.OauthGrant, auth.AccessClaims, bool, error) {
+	claims, err := auth.ParseAccessToken(tok, apiCfg.jwtKeys)
+	if err == nil {
+		if !claims.IsOAuth() || claims.ClientID != client.ID {
+			return database.OauthGrant{}, auth.AccessClaims{}, false, nil
+		}
+
+		grant, err := apiCfg.dbQueries.GetOAuthGrant(r.Context(), claims.GrantID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.OauthGrant{}, auth.AccessClaims{}, false, nil
+		}
+
+		return grant, claims, err == nil, err
+	}
+
+	grant, err := apiCfg.dbQueries.GetOAuthGrantByRefreshToken(r.Context(), auth.HashToken(tok))
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.OauthGrant{}, auth.AccessClaims{}, false, nil
+	}
+
+	if err != nil {
+		return database.OauthGrant{}, auth.AccessClaims{}, false, err
+	}
+
+	if grant.ClientID != client.ID {
+		return database.OauthGrant{}, auth.AccessClaims{}, false, nil
+	}
+
+	return grant, auth.AccessClaims{}, true, nil
+}
+
+// handlerOAuthRevoke revokes the grant behind an access or refresh token, so
+// both stop working. As RFC 7009 asks, unknown tokens are not an error.
+func (apiCfg *apiConfig) handlerOAuthRevoke(w http.ResponseWriter, r *http.Request) {
+
+	defer r.Body.Close()
+
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, oauthError{Code: "invalid_request", Description: "could not parse form"}, err)
+		return
+	}
+
+	client, err := apiCfg.authenticateClient(r)
+	if err != nil {
+		respondWithClientError(w, r, err)
+		return
+	}
+
+	grant, _, ok, err := apiCfg.clientGrant(r, client, r.PostForm.Get("token"))
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthError{Code: "server_error", Description: "could not get grant"}, err)
+		return
+	}
+
+	if ok {
+		if err := apiCfg.dbQueries.RevokeOAuthGrant(r.Context(), grant.ID); err != nil {
+			respondWithOAuthError(w, http.StatusInternalServerError, oauthError{Code: "server_error", Description: "could not revoke grant"}, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handlerOAuthIntrospect tells a client whether a token it holds is still
+// active, per RFC 7662. Tokens issued to other clients are reported as
+// inactive.
+func (apiCfg *apiConfig) handlerOAuthIntrospect(w http.ResponseWriter, r *http.Request) {
+
+	defer r.Body.Close()
+
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, oauthError{Code: "invalid_request", Description: "could not parse form"}, err)
+		return
+	}
+
+	client, err := apiCfg.authenticateClient(r)
+	if err != nil {
+		respondWithClientError(w, r, err)
+		return
+	}
+
+	type response struct {
+		Active    bool   `json:"active"`
+		Scope     string `json:"scope,omitempty"`
+		ClientID  string `json:"client_id,omitempty"`
+		Subject   string `json:"sub,omitempty"`
+		TokenType string `json:"token_type,omitempty"`
+		ExpiresAt int64  `json:"exp,omitempty"`
+		IssuedAt  int64  `json:"iat,omitempty"`
+	}
+
+	grant, claims, ok, err := apiCfg.clientGrant(r, client, r.PostForm.Get("token"))
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthError{Code: "server_error", Description: "could not get grant"}, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	if !ok {
+		respondWithJSON(w, http.StatusOK, response{Active: false})
+		return
+	}
+
+	resp := response{
+		Active:   true,
+		Scope:    strings.Join(grant.Scopes, " "),
+		ClientID: grant.ClientID.String(),
+		Subject:  grant.UserID.String(),
+	}
+
+	if claims.IsOAuth() {
+		resp.Scope = strings.Join(claims.Scopes, " ")
+		resp.TokenType = "Bearer"
+		resp.ExpiresAt = claims.ExpiresAt.Unix()
+		resp.IssuedAt = claims.IssuedAt.Unix()
+	} else {
+		resp.ExpiresAt = grant.RefreshExpiresAt.Unix()
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRedirectToClient(t *testing.T) {
+	req := authorizeRequest{
+		redirectURI: "https://app.example.com/callback?tenant=1",
+		state:       "xyz&evil=1",
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/oauth/authorize", nil)
+
+	redirectToClient(w, r, req, url.Values{"code": {"abc"}})
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, expected %d", w.Code, http.StatusFound)
+	}
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("could not parse Location: %v", err)
+	}
+
+	query := location.Query()
+	if location.Host != "app.example.com" || query.Get("tenant") != "1" || query.Get("code") != "abc" || query.Get("state") != "xyz&evil=1" {
+		t.Fatalf("unexpected redirect %s", location)
+	}
+
+	if query.Has("evil") {
+		t.Fatalf("state was not escaped: %s", location)
+	}
+}
+
+func TestRenderConsentEscapes(t *testing.T) {
+	page := consentPage{
+		ClientName: `<script>alert(1)</script>`,
+		Hidden:     map[string]string{"state": `"><script>`},
+	}
+
+	w := httptest.NewRecorder()
+	renderConsent(w, http.StatusOK, page)
+
+	body := w.Body.String()
+	if strings.Contains(body, "<script>") {
+		t.Fatalf("consent page did not escape client input:\n%s", body)
+	}
+
+	if w.Header().Get("X-Frame-Options") != "DENY" {
+		t.Fatalf("expected consent page to forbid framing")
+	}
+}
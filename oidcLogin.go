@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/7minutech/chirpy/internal/auth"
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/7minutech/chirpy/internal/oidc"
+)
+
+const (
+	oidcStateCookie   = "chirpy_oidc_state"
+	oidcLoginStateTTL = 10 * time.Minute
+)
+
+// loadOIDCProvider discovers the provider in OIDC_ISSUER, if it is set, so
+// users can log in with it. OIDC_CLIENT_ID and OIDC_REDIRECT_URL are needed
+// too, and OIDC_CLIENT_SECRET for confidential clients.
+func loadOIDCProvider(ctx context.Context) (*oidc.Provider, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+
+	provider, err := oidc.Discover(ctx, oidc.Config{
+		Issuer:       issuer,
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+	}, &http.Client{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("could not set up OIDC provider %s: %w", issuer, err)
+	}
+
+	return provider, nil
+}
+
+// setOIDCStateCookie sets the state cookie for the callback. It is only
+// marked Secure when OIDC_REDIRECT_URL is https, which is what the browser
+// sees even when TLS ends at a proxy in front of the server.
+func (apiCfg *apiConfig) setOIDCStateCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/api/login/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(strings.ToLower(apiCfg.oidc.RedirectURL()), "https://"),
+		// Lax still sends the cookie on the provider's redirect back
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// handlerOIDCLogin sends the user to the provider. The state is also set in
+// a cookie, so the callback only completes in the browser that started it.
+func (apiCfg *apiConfig) handlerOIDCLogin(w http.ResponseWriter, r *http.Request) {
+
+	if apiCfg.oidc == nil {
+		msg := "login with an OIDC provider is not enabled"
+		respondWithError(w, http.StatusNotFound, msg, nil)
+		return
+	}
+
+	// abandoned logins are cleaned up as new ones start
+	if err := apiCfg.dbQueries.DeleteExpiredOIDCLoginStates(r.Context()); err != nil {
+		log.Printf("Error deleting expired OIDC login states: %s", err)
+	}
+
+	state, err := auth.MakeRefreshToken()
+	if err != nil {
+		msg := "could not create login state"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	nonce, err := auth.MakeRefreshToken()
+	if err != nil {
+		msg := "could not create login state"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	verifier, err := auth.MakePKCEVerifier()
+	if err != nil {
+		msg := "could not create login state"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	err = apiCfg.dbQueries.CreateOIDCLoginState(r.Context(), database.CreateOIDCLoginStateParams{
+		StateHash:    auth.HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().UTC().Add(oidcLoginStateTTL),
+	})
+	if err != nil {
+		msg := "could not save login state"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	apiCfg.setOIDCStateCookie(w, state, int(oidcLoginStateTTL.Seconds()))
+
+	http.Redirect(w, r, apiCfg.oidc.AuthCodeURL(state, nonce, auth.PKCEChallenge(verifier)), http.StatusFound)
+}
+
+// handlerOIDCCallback is where the provider sends the user back. The ID
+// token's identity is logged in as the user it is linked to, linking or
+// creating one by email the first time, and the response is the same as
+// /api/login's.
+func (apiCfg *apiConfig) handlerOIDCCallback(w http.ResponseWriter, r *http.Request) {
+
+	if apiCfg.oidc == nil {
+		msg := "login with an OIDC provider is not enabled"
+		respondWithError(w, http.StatusNotFound, msg, nil)
+		return
+	}
+
+	query := r.URL.Query()
+
+	// whatever happens the state can't be used again
+	apiCfg.setOIDCStateCookie(w, "", -1)
+
+	if providerErr := query.Get("error"); providerErr != "" {
+		msg := fmt.Sprintf("provider did not log you in: %s", providerErr)
+		respondWithError(w, http.StatusUnauthorized, msg, nil)
+		return
+	}
+
+	state := query.Get("state")
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		msg := "login state does not match, start again"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	loginState, err := apiCfg.dbQueries.UseOIDCLoginState(r.Context(), auth.HashToken(state))
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := "login has expired, start again"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	if err != nil {
+		msg := "could not get login state"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	idToken, err := apiCfg.oidc.Exchange(r.Context(), query.Get("code"), loginState.CodeVerifier)
+	if err != nil {
+		msg := "could not exchange code with provider"
+		respondWithError(w, http.StatusBadGateway, msg, err)
+		return
+	}
+
+	identity, err := apiCfg.oidc.VerifyIDToken(r.Context(), idToken, loginState.Nonce)
+	if err != nil {
+		msg := "provider's id token is not valid"
+		respondWithError(w, http.StatusUnauthorized, msg, err)
+		return
+	}
+
+	user, refusal, err := apiCfg.identityUser(r.Context(), identity)
+	if err != nil {
+		msg := "could not get user for identity"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if refusal != nil {
+		respondWithError(w, refusal.code, refusal.msg, nil)
+		return
+	}
+
+	apiCfg.loginUser(w, r, user)
+}
+
+// identityRefusal is why an identity can't be logged in as any user.
+type identityRefusal struct {
+	code int
+	msg  string
+}
+
+// identityUser returns the user identity is linked to. An identity seen for
+// the first time is linked to the user with its email, or to a new user
+// without a password, which can be set later through a password reset.
+func (apiCfg *apiConfig) identityUser(ctx context.Context, identity oidc.Identity) (database.User, *identityRefusal, error) {
+	linked, err := apiCfg.dbQueries.GetUserIdentity(ctx, database.GetUserIdentityParams{
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+	})
+	if err == nil {
+		user, err := apiCfg.dbQueries.GetUser(ctx, linked.UserID)
+		return user, nil, err
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, nil, err
+	}
+
+	// an unverified email could belong to anyone, so it can't be trusted to
+	// pick the account
+	if identity.Email == "" || !identity.EmailVerified || !validEmail(identity.Email) {
+		msg := "provider did not share a verified email address"
+		return database.User{}, &identityRefusal{code: http.StatusForbidden, msg: msg}, nil
+	}
+
+	tx, err := apiCfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, nil, err
+	}
+	defer tx.Rollback()
+
+	qtx := apiCfg.dbQueries.WithTx(tx)
+
+	user, err := qtx.GetUserByEmail(ctx, identity.Email)
+
+	if err == nil && !user.EmailVerifiedAt.Valid {
+		// whoever signed up with this email never proved they own it, and
+		// linking would leave them a way into the provider user's account
+		msg := "an account with this email exists but its email is not verified, verify it first"
+		return database.User{}, &identityRefusal{code: http.StatusConflict, msg: msg}, nil
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		user, err = qtx.CreateUser(ctx, database.CreateUserParams{
+			Email: identity.Email,
+		})
+		if err == nil {
+			user, err = qtx.VerifyUserEmail(ctx, user.ID)
+		}
+	}
+
+	if err == nil {
+		_, err = qtx.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+			UserID:  user.ID,
+			Issuer:  identity.Issuer,
+			Subject: identity.Subject,
+			Email:   identity.Email,
+		})
+	}
+
+	// another callback for the same new identity or email got there first
+	if isUniqueViolation(err) {
+		msg := "account was created by another login, try again"
+		return database.User{}, &identityRefusal{code: http.StatusConflict, msg: msg}, nil
+	}
+
+	if err != nil {
+		return database.User{}, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return database.User{}, nil, err
+	}
+
+	return user, nil, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/7minutech/chirpy/internal/oidc/oidctest"
+)
+
+func TestLoadOIDCProvider(t *testing.T) {
+	t.Setenv("OIDC_ISSUER", "")
+
+	provider, err := loadOIDCProvider(context.Background())
+	if provider != nil || err != nil {
+		t.Fatalf("expected no provider without OIDC_ISSUER, got %v, %v", provider, err)
+	}
+
+	server := oidctest.NewServer("chirpy", "s3cret")
+	defer server.Close()
+
+	t.Setenv("OIDC_ISSUER", server.Issuer())
+	t.Setenv("OIDC_CLIENT_ID", "chirpy")
+	t.Setenv("OIDC_CLIENT_SECRET", "s3cret")
+	t.Setenv("OIDC_REDIRECT_URL", "http://localhost:8080/api/login/oidc/callback")
+
+	provider, err = loadOIDCProvider(context.Background())
+	if err != nil || provider == nil || provider.Issuer() != server.Issuer() {
+		t.Fatalf("loadOIDCProvider = %v, %v", provider, err)
+	}
+
+	t.Setenv("OIDC_REDIRECT_URL", "")
+
+	if _, err := loadOIDCProvider(context.Background()); err == nil {
+		t.Fatalf("expected a missing OIDC_REDIRECT_URL to be rejected")
+	}
+}
+
+func TestOIDCCallbackChecksState(t *testing.T) {
+	server := oidctest.NewServer("chirpy", "s3cret")
+	defer server.Close()
+
+	t.Setenv("OIDC_ISSUER", server.Issuer())
+	t.Setenv("OIDC_CLIENT_ID", "chirpy")
+	t.Setenv("OIDC_CLIENT_SECRET", "s3cret")
+	t.Setenv("OIDC_REDIRECT_URL", "http://localhost:8080/api/login/oidc/callback")
+
+	provider, err := loadOIDCProvider(context.Background())
+	if err != nil {
+		t.Fatalf("loadOIDCProvider err = %v", err)
+	}
+
+	apiCfg := &apiConfig{oidc: provider}
+
+	cases := []struct {
+		name   string
+		cookie string
+	}{
+		{name: "no cookie"},
+		{name: "other state", cookie: "not-the-state"},
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/api/login/oidc/callback?code=abc&state=the-state", nil)
+		if c.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: c.cookie})
+		}
+
+		apiCfg.handlerOIDCCallback(w, r)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, expected %d", c.name, w.Code, http.StatusBadRequest)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/login/oidc/callback", nil)
+
+	(&apiConfig{}).handlerOIDCCallback(w, r)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d without a provider, expected %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestOIDCStateCookieSecure(t *testing.T) {
+	server := oidctest.NewServer("chirpy", "s3cret")
+	defer server.Close()
+
+	t.Setenv("OIDC_ISSUER", server.Issuer())
+	t.Setenv("OIDC_CLIENT_ID", "chirpy")
+	t.Setenv("OIDC_CLIENT_SECRET", "s3cret")
+
+	cases := []struct {
+		redirectURL string
+		secure      bool
+	}{
+		{redirectURL: "http://localhost:8080/api/login/oidc/callback", secure: false},
+		{redirectURL: "https://chirpy.example.com/api/login/oidc/callback", secure: true},
+	}
+
+	for _, c := range cases {
+		t.Setenv("OIDC_REDIRECT_URL", c.redirectURL)
+
+		provider, err := loadOIDCProvider(context.Background())
+		if err != nil {
+			t.Fatalf("loadOIDCProvider err = %v", err)
+		}
+
+		w := httptest.NewRecorder()
+		(&apiConfig{oidc: provider}).setOIDCStateCookie(w, "the-state", 600)
+
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Secure != c.secure {
+			t.Errorf("%s: cookies = %v, expected Secure %t", c.redirectURL, cookies, c.secure)
+		}
+	}
+}
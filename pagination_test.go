@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestEncodeAndDecodeCursor(t *testing.T) {
+	createdAt := time.Date(2025, time.April, 10, 20, 0, 0, 123456000, time.UTC)
+	id := uuid.New()
+
+	cursor := encodeCursor(createdAt, id)
+
+	gotCreatedAt, gotID, err := decodeCursor(cursor)
+	if err != nil {
+		t.Fatalf("decodeCursor(%q) err: %v", cursor, err)
+	}
+
+	if !gotCreatedAt.Equal(createdAt) {
+		t.Errorf("created_at == %v, expected: %v", gotCreatedAt, createdAt)
+	}
+
+	if gotID != id {
+		t.Errorf("id == %v, expected: %v", gotID, id)
+	}
+}
+
+func TestDecodeCursor_Invalid(t *testing.T) {
+	cases := []string{
+		"not base64!",
+		"bm8tc2VwYXJhdG9y",
+		encodeCursor(time.Now(), uuid.New())[:10],
+	}
+
+	for _, c := range cases {
+		if _, _, err := decodeCursor(c); err == nil {
+			t.Errorf("decodeCursor(%q) expected err", c)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/7minutech/chirpy/internal/auth"
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/7minutech/chirpy/internal/lockout"
+	"github.com/7minutech/chirpy/internal/mailer"
+)
+
+const (
+	passwordResetTokenTTL = time.Hour
+	// passwordResetSendTimeout bounds a reset sent after the response, when
+	// the request's context is already done
+	passwordResetSendTimeout = time.Minute
+)
+
+// passwordResetPolicy caps how many reset emails one address can be sent,
+// and how many one client can ask for, so the endpoint can't be used to
+// flood inboxes.
+var passwordResetPolicy = lockout.Policy{
+	BaseDelay:       0,
+	MaxDelay:        0,
+	MaxFailures:     5,
+	LockoutDuration: time.Hour,
+	Window:          time.Hour,
+}
+
+func (apiCfg *apiConfig) handlerForgotPassword(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	var params parameters
+
+	defer r.Body.Close()
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		msg := "could not decode request body"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	// the response is the same, and just as quick, whether or not the email
+	// belongs to a user or is over the limit, so this endpoint can't be used
+	// to find out who has an account
+	if err := apiCfg.requestPasswordReset(r, params.Email); err != nil {
+		msg := "could not check password reset requests"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, nil)
+}
+
+func passwordResetAccountKey(email string) string {
+	return "reset:account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func passwordResetIPKey(r *http.Request) string {
+	return "reset:ip:" + clientIP(r)
+}
+
+// requestPasswordReset sends a reset to email in the background, unless the
+// email or the client's address has asked for too many already.
+func (apiCfg *apiConfig) requestPasswordReset(r *http.Request, email string) error {
+	keys := []string{passwordResetIPKey(r), passwordResetAccountKey(email)}
+
+	for i, key := range keys {
+		wait, _, err := apiCfg.resetLimiter.Check(r.Context(), key)
+		if err != nil || wait > 0 {
+			apiCfg.releasePasswordResetKeys(r, keys[:i])
+			return err
+		}
+	}
+	defer apiCfg.releasePasswordResetKeys(r, keys)
+
+	// sends are counted before the reservations are released, so requests
+	// racing this one see them
+	for _, key := range keys {
+		if _, _, err := apiCfg.resetLimiter.Fail(r.Context(), key); err != nil {
+			return err
+		}
+	}
+
+	apiCfg.sendPasswordResetLater(email)
+
+	return nil
+}
+
+func (apiCfg *apiConfig) releasePasswordResetKeys(r *http.Request, keys []string) {
+	for _, key := range keys {
+		if err := apiCfg.resetLimiter.Release(r.Context(), key); err != nil {
+			log.Printf("Error releasing password reset request: %s", err)
+		}
+	}
+}
+
+// sendPasswordResetLater runs sendPasswordReset in the background, so the
+// database work and email for a real account don't slow the response down.
+func (apiCfg *apiConfig) sendPasswordResetLater(email string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), passwordResetSendTimeout)
+		defer cancel()
+
+		if err := apiCfg.sendPasswordReset(ctx, email); err != nil {
+			log.Printf("Error sending password reset: %s", err)
+		}
+	}()
+}
+
+// sendPasswordReset emails a reset token to the user with email, if there is
+// one. Only the token's hash is stored.
+func (apiCfg *apiConfig) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := apiCfg.dbQueries.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := apiCfg.dbQueries.DeleteUserPasswordResetTokens(ctx, user.ID); err != nil {
+		return err
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	_, err = apiCfg.dbQueries.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(passwordResetTokenTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	return apiCfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for this account. If it was you, send this token "+
+			"with your new password to POST /api/password/reset:\n\n%s\n\nThe token expires in %d minutes. "+
+			"If you didn't ask for a reset you can ignore this email.\n", token, int(passwordResetTokenTTL.Minutes())),
+	})
+}
+
+func (apiCfg *apiConfig) handlerResetPassword(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	var params parameters
+
+	defer r.Body.Close()
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		msg := "could not decode request body"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		msg := "could not start transaction"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := apiCfg.dbQueries.WithTx(tx)
+
+	reset, err := qtx.UsePasswordResetToken(r.Context(), auth.HashToken(params.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := "reset token is invalid or expired"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	if err != nil {
+		msg := "could not reset password"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	user, err := qtx.GetUser(r.Context(), reset.UserID)
+	if err != nil {
+		msg := "could not get user"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	// returning before the commit leaves the token unused, so it can be
+	// tried again with a better password
+	if !apiCfg.checkPassword(w, params.Password, user.Email) {
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(params.Password, apiCfg.passwordParams)
+	if err != nil {
+		msg := "could not hash password"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	_, err = qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		HashedPassword: sql.NullString{String: hashedPassword, Valid: true},
+		ID:             reset.UserID,
+	})
+	if err != nil {
+		msg := "could not reset password"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	// whoever knew the old password may still be logged in
+	if err := qtx.RevokeUserRefreshTokens(r.Context(), reset.UserID); err != nil {
+		msg := "could not revoke refresh tokens"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	// or may have handed themselves access through an app or token
+	if err := qtx.RevokeUserOAuthGrants(r.Context(), reset.UserID); err != nil {
+		msg := "could not revoke app access"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if err := qtx.RevokeUserPersonalAccessTokens(r.Context(), reset.UserID); err != nil {
+		msg := "could not revoke personal access tokens"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		msg := "could not reset password"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusNoContent, nil)
+}
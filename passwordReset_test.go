@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/7minutech/chirpy/internal/lockout"
+	"github.com/7minutech/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+// newPasswordResetConfig returns an apiConfig that sends resets for the user
+// with email to the returned outbox.
+func newPasswordResetConfig(t *testing.T, email string, hashedPassword any) (*apiConfig, *fakeDB, *mailer.Outbox) {
+	fake, db := newFakeDB(t)
+
+	user := map[string]any{"id": uuid.New(), "email": email, "hashed_password": hashedPassword}
+
+	fake.answer("GetUserByEmail", func(args []driver.Value) ([]map[string]any, error) {
+		if args[0] != email {
+			return nil, nil
+		}
+		return []map[string]any{user}, nil
+	})
+
+	fake.answer("CreatePasswordResetToken", func(args []driver.Value) ([]map[string]any, error) {
+		return []map[string]any{{"token_hash": args[0], "user_id": args[1], "expires_at": args[2]}}, nil
+	})
+
+	store := lockout.NewMemoryStore()
+	outbox := mailer.NewOutbox("")
+
+	apiCfg := &apiConfig{
+		db:             db,
+		dbQueries:      database.New(db),
+		mailer:         outbox,
+		accountLimiter: lockout.New(store, accountLoginPolicy),
+		ipLimiter:      lockout.New(store, ipLoginPolicy),
+		resetLimiter:   lockout.New(store, passwordResetPolicy),
+	}
+
+	return apiCfg, fake, outbox
+}
+
+// waitForMessages waits for the resets sent in the background to reach the
+// outbox, and returns the messages once there are at least n.
+func waitForMessages(t *testing.T, outbox *mailer.Outbox, n int) []mailer.Message {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(outbox.Messages()) < n && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return outbox.Messages()
+}
+
+func TestForgotPasswordIsLimited(t *testing.T) {
+	const email = "walt@example.com"
+
+	apiCfg, _, outbox := newPasswordResetConfig(t, email, "hash")
+
+	requests := passwordResetPolicy.MaxFailures + 2
+	for range requests {
+		r := httptest.NewRequest(http.MethodPost, "/api/password/forgot", strings.NewReader(`{"email": "`+email+`"}`))
+		w := httptest.NewRecorder()
+
+		apiCfg.handlerForgotPassword(w, r)
+
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, expected %d even over the limit", w.Code, http.StatusAccepted)
+		}
+	}
+
+	messages := waitForMessages(t, outbox, passwordResetPolicy.MaxFailures)
+	if len(messages) != passwordResetPolicy.MaxFailures {
+		t.Errorf("%d requests sent %d emails, expected %d", requests, len(messages), passwordResetPolicy.MaxFailures)
+	}
+
+	// the limit is per address too, not just per email
+	r := httptest.NewRequest(http.MethodPost, "/api/password/forgot", strings.NewReader(`{"email": "jesse@example.com"}`))
+	w := httptest.NewRecorder()
+
+	apiCfg.handlerForgotPassword(w, r)
+
+	if got, _, _ := apiCfg.resetLimiter.Check(r.Context(), passwordResetIPKey(r)); got == 0 {
+		t.Errorf("address is not limited after %d requests", requests+1)
+	}
+}
+
+func TestLoginWithoutPasswordSendsReset(t *testing.T) {
+	const email = "saul@example.com"
+
+	apiCfg, fake, outbox := newPasswordResetConfig(t, email, nil)
+
+	r := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"email": "`+email+`", "password": "guess"}`))
+	w := httptest.NewRecorder()
+
+	apiCfg.handlerLogin(w, r)
+
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "Incorrect email or password") {
+		t.Errorf("response = %d %s, expected the same 401 as a wrong password", w.Code, w.Body.String())
+	}
+
+	messages := waitForMessages(t, outbox, 1)
+	if len(messages) != 1 || messages[0].To != email {
+		t.Fatalf("sent %v, expected a reset to %s", messages, email)
+	}
+
+	if calls := fake.callsTo("CreatePasswordResetToken"); len(calls) != 1 {
+		t.Errorf("created %d reset tokens, expected 1", len(calls))
+	}
+}
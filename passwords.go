@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/7minutech/chirpy/internal/auth"
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/7minutech/chirpy/internal/passwords"
+)
+
+// loadPasswordParams starts from the argon2id defaults and applies any of
+// ARGON2_MEMORY_KIB, ARGON2_ITERATIONS and ARGON2_PARALLELISM that are set.
+// Raising them only affects new hashes; old ones are upgraded as their users
+// log in.
+func loadPasswordParams() (*auth.PasswordParams, error) {
+	params := auth.DefaultPasswordParams()
+
+	settings := []struct {
+		name string
+		bits int
+		set  func(uint64)
+	}{
+		{"ARGON2_MEMORY_KIB", 32, func(v uint64) { params.Memory = uint32(v) }},
+		{"ARGON2_ITERATIONS", 32, func(v uint64) { params.Iterations = uint32(v) }},
+		{"ARGON2_PARALLELISM", 8, func(v uint64) { params.Parallelism = uint8(v) }},
+	}
+
+	for _, setting := range settings {
+		value := os.Getenv(setting.name)
+		if value == "" {
+			continue
+		}
+
+		n, err := strconv.ParseUint(value, 10, setting.bits)
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("%s must be a positive integer", setting.name)
+		}
+		setting.set(n)
+	}
+
+	return params, nil
+}
+
+// rehashPassword replaces user's hash with one made with the current
+// parameters, if it was made with different ones. It is only called once the
+// password has been checked, and a failure just leaves the old hash in place.
+func (apiCfg *apiConfig) rehashPassword(ctx context.Context, user database.User, password string) {
+	if !auth.NeedsRehash(user.HashedPassword.String, apiCfg.passwordParams) {
+		return
+	}
+
+	newHash, err := auth.HashPassword(password, apiCfg.passwordParams)
+	if err != nil {
+		log.Printf("Error rehashing password: %s", err)
+		return
+	}
+
+	// the old hash in the WHERE clause keeps this from undoing a password
+	// change that happened meanwhile
+	err = apiCfg.dbQueries.RehashUserPassword(ctx, database.RehashUserPasswordParams{
+		NewHash: sql.NullString{String: newHash, Valid: true},
+		ID:      user.ID,
+		OldHash: user.HashedPassword,
+	})
+	if err != nil {
+		log.Printf("Error rehashing password: %s", err)
+	}
+}
+
+// loadPasswordPolicy applies PASSWORD_MIN_LENGTH and PASSWORD_MAX_LENGTH to
+// the default policy, and loads BREACHED_PASSWORDS_FILE when it is set.
+func loadPasswordPolicy() (passwords.Policy, error) {
+	policy := passwords.DefaultPolicy()
+
+	for name, length := range map[string]*int{
+		"PASSWORD_MIN_LENGTH": &policy.MinLength,
+		"PASSWORD_MAX_LENGTH": &policy.MaxLength,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return passwords.Policy{}, fmt.Errorf("%s must be a positive integer", name)
+		}
+		*length = n
+	}
+
+	if policy.MaxLength < policy.MinLength {
+		return passwords.Policy{}, fmt.Errorf("PASSWORD_MAX_LENGTH can not be less than PASSWORD_MIN_LENGTH")
+	}
+
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		breached, err := passwords.LoadBreachedList(path)
+		if err != nil {
+			return passwords.Policy{}, err
+		}
+		log.Printf("Loaded %d breached passwords", breached.Len())
+		policy.Breached = breached
+	}
+
+	return policy, nil
+}
+
+// checkPassword responds with every rule password breaks and returns false,
+// or returns true if the policy accepts it.
+func (apiCfg *apiConfig) checkPassword(w http.ResponseWriter, password, email string) bool {
+	violations := apiCfg.passwordPolicy.Check(password, email)
+	if len(violations) == 0 {
+		return true
+	}
+
+	type response struct {
+		Error      string                `json:"error"`
+		Violations []passwords.Violation `json:"violations"`
+	}
+
+	respondWithJSON(w, http.StatusBadRequest, response{
+		Error:      "password does not meet the requirements",
+		Violations: violations,
+	})
+	return false
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/7minutech/chirpy/internal/auth"
+)
+
+func TestLoadPasswordParams(t *testing.T) {
+	t.Setenv("ARGON2_MEMORY_KIB", "")
+	t.Setenv("ARGON2_ITERATIONS", "")
+	t.Setenv("ARGON2_PARALLELISM", "")
+
+	params, err := loadPasswordParams()
+	if err != nil {
+		t.Fatalf("loadPasswordParams err = %v", err)
+	}
+
+	if *params != *auth.DefaultPasswordParams() {
+		t.Fatalf("expected defaults, got %+v", *params)
+	}
+
+	t.Setenv("ARGON2_MEMORY_KIB", "131072")
+	t.Setenv("ARGON2_ITERATIONS", "4")
+
+	params, err = loadPasswordParams()
+	if err != nil {
+		t.Fatalf("loadPasswordParams err = %v", err)
+	}
+
+	if params.Memory != 131072 || params.Iterations != 4 || params.Parallelism != auth.DefaultPasswordParams().Parallelism {
+		t.Fatalf("unexpected params %+v", *params)
+	}
+
+	for _, value := range []string{"0", "-1", "lots", "256"} {
+		t.Setenv("ARGON2_PARALLELISM", value)
+		if _, err := loadPasswordParams(); err == nil {
+			t.Errorf("expected ARGON2_PARALLELISM=%q to be rejected", value)
+		}
+	}
+}
+
+func TestLoadPasswordPolicy(t *testing.T) {
+	t.Setenv("PASSWORD_MIN_LENGTH", "12")
+	t.Setenv("PASSWORD_MAX_LENGTH", "")
+	t.Setenv("BREACHED_PASSWORDS_FILE", "")
+
+	policy, err := loadPasswordPolicy()
+	if err != nil {
+		t.Fatalf("loadPasswordPolicy err = %v", err)
+	}
+
+	if policy.MinLength != 12 || policy.MaxLength != 128 || policy.Breached != nil {
+		t.Fatalf("unexpected policy %+v", policy)
+	}
+
+	t.Setenv("PASSWORD_MAX_LENGTH", "10")
+	if _, err := loadPasswordPolicy(); err == nil {
+		t.Errorf("expected a maximum below the minimum to be rejected")
+	}
+}
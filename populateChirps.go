@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// viewerID returns the user making the request when it carries a valid
+// bearer token. Endpoints that work without logging in use it to personalize
+// their response, so a missing or invalid token is not an error. Reads that
+// happen to carry a personal access token don't count as using it, so they
+// stay reads.
+func (apiCfg *apiConfig) viewerID(r *http.Request) uuid.NullUUID {
+	userID, err := apiCfg.authenticateToken(r, scopeChirpsRead, false)
+	if err != nil {
+		return uuid.NullUUID{}
+	}
+
+	return uuid.NullUUID{UUID: userID, Valid: true}
+}
+
+// populateChirps fills in the fields of chirps that are not stored on the
+// chirps row itself, using one query per field for the whole slice.
+// liked_by_me is only set when viewerID is valid.
+func (apiCfg *apiConfig) populateChirps(ctx context.Context, chirps []Chirp, viewerID uuid.NullUUID) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(chirps))
+	for i, chirp := range chirps {
+		ids[i] = chirp.ID
+	}
+
+	dbReplyCounts, err := apiCfg.dbQueries.GetReplyCounts(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	replyCounts := make(map[uuid.UUID]int64, len(dbReplyCounts))
+	for _, dbReplyCount := range dbReplyCounts {
+		replyCounts[dbReplyCount.InReplyTo.UUID] = dbReplyCount.ReplyCount
+	}
+
+	dbLikeCounts, err := apiCfg.dbQueries.GetLikeCounts(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	likeCounts := make(map[uuid.UUID]int64, len(dbLikeCounts))
+	for _, dbLikeCount := range dbLikeCounts {
+		likeCounts[dbLikeCount.ChirpID] = dbLikeCount.LikeCount
+	}
+
+	likedByViewer := make(map[uuid.UUID]bool)
+	if viewerID.Valid {
+		likedParams := database.GetLikedChirpIDsParams{
+			UserID: viewerID.UUID,
+			Ids:    ids,
+		}
+
+		likedIDs, err := apiCfg.dbQueries.GetLikedChirpIDs(ctx, likedParams)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range likedIDs {
+			likedByViewer[id] = true
+		}
+	}
+
+	for i := range chirps {
+		chirps[i].ReplyCount = replyCounts[chirps[i].ID]
+		chirps[i].LikeCount = likeCounts[chirps[i].ID]
+		chirps[i].LikedByMe = likedByViewer[chirps[i].ID]
+	}
+
+	return apiCfg.addReferencedChirps(ctx, chirps)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxLocationLength    = 30
+)
+
+// Profile is the public view of a user. It must never include the email or
+// password hash.
+type Profile struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	Handle         string    `json:"handle"`
+	DisplayName    string    `json:"display_name"`
+	Bio            string    `json:"bio"`
+	Location       string    `json:"location"`
+	Red            bool      `json:"is_chirpy_red"`
+	FollowerCount  int64     `json:"follower_count"`
+	FollowingCount int64     `json:"following_count"`
+}
+
+// profileUpdate holds the profile fields of a user update request. Nil
+// fields are left unchanged.
+type profileUpdate struct {
+	Handle      *string `json:"handle"`
+	DisplayName *string `json:"display_name"`
+	Bio         *string `json:"bio"`
+	Location    *string `json:"location"`
+}
+
+func (p profileUpdate) empty() bool {
+	return p.Handle == nil && p.DisplayName == nil && p.Bio == nil && p.Location == nil
+}
+
+func (p profileUpdate) validate() error {
+	if p.Handle != nil && !handlePattern.MatchString(*p.Handle) {
+		return errors.New("handle must be 3 to 30 letters, numbers or underscores")
+	}
+
+	if p.DisplayName != nil && utf8.RuneCountInString(*p.DisplayName) > maxDisplayNameLength {
+		return fmt.Errorf("display_name must be at most %d characters", maxDisplayNameLength)
+	}
+
+	if p.Bio != nil && utf8.RuneCountInString(*p.Bio) > maxBioLength {
+		return fmt.Errorf("bio must be at most %d characters", maxBioLength)
+	}
+
+	if p.Location != nil && utf8.RuneCountInString(*p.Location) > maxLocationLength {
+		return fmt.Errorf("location must be at most %d characters", maxLocationLength)
+	}
+
+	return nil
+}
+
+func (p profileUpdate) params(userID uuid.UUID) database.UpdateUserProfileParams {
+	return database.UpdateUserProfileParams{
+		Handle:      toNullString(p.Handle),
+		DisplayName: toNullString(p.DisplayName),
+		Bio:         toNullString(p.Bio),
+		Location:    toNullString(p.Location),
+		ID:          userID,
+	}
+}
+
+func toNullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
+}
+
+func (apiCfg *apiConfig) handlerGetProfile(w http.ResponseWriter, r *http.Request) {
+
+	handleOrID := r.PathValue("handleOrID")
+
+	var user database.User
+	var err error
+
+	if userID, parseErr := uuid.Parse(handleOrID); parseErr == nil {
+		user, err = apiCfg.dbQueries.GetUser(r.Context(), userID)
+	} else {
+		user, err = apiCfg.dbQueries.GetUserByHandle(r.Context(), handleOrID)
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := "user does not exist"
+		respondWithError(w, http.StatusNotFound, msg, err)
+		return
+	}
+
+	if err != nil {
+		msg := "could not get user"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	followerCount, err := apiCfg.dbQueries.CountFollowers(r.Context(), user.ID)
+	if err != nil {
+		msg := "could not count followers"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	followingCount, err := apiCfg.dbQueries.CountFollowing(r.Context(), user.ID)
+	if err != nil {
+		msg := "could not count followed users"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	profile := Profile{
+		ID:             user.ID,
+		CreatedAt:      user.CreatedAt,
+		Handle:         user.Handle.String,
+		DisplayName:    user.DisplayName,
+		Bio:            user.Bio,
+		Location:       user.Location,
+		Red:            user.IsChirpyRed,
+		FollowerCount:  followerCount,
+		FollowingCount: followingCount,
+	}
+
+	respondWithJSON(w, http.StatusOK, profile)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProfileUpdateValidate(t *testing.T) {
+	ptr := func(s string) *string { return &s }
+
+	cases := []struct {
+		input   profileUpdate
+		wantErr bool
+	}{
+		{
+			input:   profileUpdate{},
+			wantErr: false,
+		},
+		{
+			input: profileUpdate{
+				Handle:      ptr("chirper_01"),
+				DisplayName: ptr("Chirper"),
+				Bio:         ptr(""),
+				Location:    ptr("Zürich"),
+			},
+			wantErr: false,
+		},
+		{
+			input:   profileUpdate{Handle: ptr("no spaces")},
+			wantErr: true,
+		},
+		{
+			input:   profileUpdate{Handle: ptr("")},
+			wantErr: true,
+		},
+		{
+			input:   profileUpdate{DisplayName: ptr(strings.Repeat("a", maxDisplayNameLength+1))},
+			wantErr: true,
+		},
+		{
+			input:   profileUpdate{Bio: ptr(strings.Repeat("é", maxBioLength))},
+			wantErr: false,
+		},
+		{
+			input:   profileUpdate{Location: ptr(strings.Repeat("a", maxLocationLength+1))},
+			wantErr: true,
+		},
+	}
+
+	for i, c := range cases {
+		err := c.input.validate()
+		if (err != nil) != c.wantErr {
+			t.Errorf("cases[%d].validate() err == %v, wantErr: %t", i, err, c.wantErr)
+		}
+	}
+}
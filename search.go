@@ -0,0 +1,132 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type SearchResult struct {
+	Chirp
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// parseSearchTime accepts either a full RFC 3339 timestamp or a plain date,
+// which is read as midnight UTC.
+func parseSearchTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+func (apiCfg *apiConfig) handlerSearchChirps(w http.ResponseWriter, r *http.Request) {
+
+	query := r.URL.Query()
+
+	searchQuery := strings.TrimSpace(query.Get("q"))
+	if searchQuery == "" {
+		msg := "search query q is required"
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	searchParams := database.SearchChirpsParams{
+		Query:    searchQuery,
+		RowLimit: defaultChirpPageSize,
+	}
+
+	if authorStrID := query.Get("author_id"); authorStrID != "" {
+
+		authorID, err := uuid.Parse(authorStrID)
+		if err != nil {
+			msg := "could not parse author id"
+			respondWithError(w, http.StatusBadRequest, msg, err)
+			return
+		}
+
+		searchParams.AuthorID = uuid.NullUUID{UUID: authorID, Valid: true}
+	}
+
+	if sinceStr := query.Get("since"); sinceStr != "" {
+
+		since, err := parseSearchTime(sinceStr)
+		if err != nil {
+			msg := "could not parse since"
+			respondWithError(w, http.StatusBadRequest, msg, err)
+			return
+		}
+
+		searchParams.Since = sql.NullTime{Time: since, Valid: true}
+	}
+
+	if untilStr := query.Get("until"); untilStr != "" {
+
+		until, err := parseSearchTime(untilStr)
+		if err != nil {
+			msg := "could not parse until"
+			respondWithError(w, http.StatusBadRequest, msg, err)
+			return
+		}
+
+		searchParams.Until = sql.NullTime{Time: until, Valid: true}
+	}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxChirpPageSize {
+			msg := fmt.Sprintf("limit must be between 1 and %d", maxChirpPageSize)
+			respondWithError(w, http.StatusBadRequest, msg, err)
+			return
+		}
+
+		searchParams.RowLimit = int32(limit)
+	}
+
+	rows, err := apiCfg.dbQueries.SearchChirps(r.Context(), searchParams)
+	if err != nil {
+		msg := "could not search chirps"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	chirps := make([]Chirp, len(rows))
+	for i, row := range rows {
+		chirps[i] = convertChirp(database.Chirp{
+			ID:        row.ID,
+			CreatedAt: row.CreatedAt,
+			UpdatedAt: row.UpdatedAt,
+			Body:      row.Body,
+			UserID:    row.UserID,
+			InReplyTo: row.InReplyTo,
+			Kind:      row.Kind,
+			RechirpOf: row.RechirpOf,
+			QuoteOf:   row.QuoteOf,
+		})
+	}
+
+	if err := apiCfg.populateChirps(r.Context(), chirps, apiCfg.viewerID(r)); err != nil {
+		msg := "could not get chirp details"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	results := make([]SearchResult, len(rows))
+	for i, row := range rows {
+		results[i] = SearchResult{
+			Chirp:   chirps[i],
+			Rank:    row.Rank,
+			Snippet: row.Snippet,
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, results)
+}
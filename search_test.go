@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSearchTime(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected time.Time
+	}{
+		{
+			input:    "2025-04-10",
+			expected: time.Date(2025, time.April, 10, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			input:    "2025-04-10T20:30:00Z",
+			expected: time.Date(2025, time.April, 10, 20, 30, 0, 0, time.UTC),
+		},
+		{
+			input:    "2025-04-10T20:30:00-04:00",
+			expected: time.Date(2025, time.April, 11, 0, 30, 0, 0, time.UTC),
+		},
+	}
+
+	for _, c := range cases {
+		actual, err := parseSearchTime(c.input)
+		if err != nil {
+			t.Errorf("parseSearchTime(%s) err: %v", c.input, err)
+			continue
+		}
+
+		if !actual.Equal(c.expected) {
+			t.Errorf("parseSearchTime(%s) == %v, expected: %v", c.input, actual, c.expected)
+		}
+	}
+
+	if _, err := parseSearchTime("yesterday"); err == nil {
+		t.Errorf("parseSearchTime(yesterday) expected err")
+	}
+}
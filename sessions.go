@@ -0,0 +1,199 @@
+package main
+
+import (
+	"database/sql"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/7minutech/chirpy/internal/auth"
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxUserAgentLength = 512
+
+// Session is one login on one device. Its ID is the refresh token family, so
+// it stays the same as the refresh token is rotated. The token itself is
+// never exposed.
+type Session struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+}
+
+// convertSession maps a single refresh token. Every refresh rotates the
+// token, so a token was last used when it was created.
+func convertSession(dbRefreshToken database.RefreshToken) Session {
+	session := Session{
+		ID:         dbRefreshToken.FamilyID,
+		CreatedAt:  dbRefreshToken.CreatedAt,
+		LastUsedAt: dbRefreshToken.CreatedAt,
+		ExpiresAt:  dbRefreshToken.ExpiresAt,
+		UserAgent:  dbRefreshToken.UserAgent,
+		IPAddress:  dbRefreshToken.IpAddress,
+	}
+	if dbRefreshToken.RevokedAt.Valid {
+		session.RevokedAt = &dbRefreshToken.RevokedAt.Time
+	}
+	return session
+}
+
+// clientIP is the address the request came from. X-Forwarded-For is ignored
+// because any client can set it.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clientUserAgent is the request's User-Agent, made valid UTF-8 so Postgres
+// will store it, and cut to at most maxUserAgentLength bytes without
+// splitting a character.
+func clientUserAgent(r *http.Request) string {
+	userAgent := strings.ToValidUTF8(r.UserAgent(), "\uFFFD")
+	if len(userAgent) <= maxUserAgentLength {
+		return userAgent
+	}
+
+	end := maxUserAgentLength
+	for end > 0 && !utf8.RuneStart(userAgent[end]) {
+		end--
+	}
+	return userAgent[:end]
+}
+
+// issueRefreshToken creates a refresh token for userID. Every token in a
+// family descends from the same login through rotation, so the whole family
+// can be revoked if an old token is replayed. Only the token's digest is
+// stored; the token itself is returned once, to be handed to the client.
+func issueRefreshToken(r *http.Request, queries *database.Queries, userID, familyID uuid.UUID) (string, error) {
+	refreshTok, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = queries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		TokenHash: auth.HashToken(refreshTok),
+		UserID:    userID,
+		ExpiresAt: time.Now().AddDate(0, 0, expirationDays),
+		RevokedAt: sql.NullTime{},
+		FamilyID:  familyID,
+		UserAgent: clientUserAgent(r),
+		IpAddress: clientIP(r),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return refreshTok, nil
+}
+
+// rejectReusedRefreshToken revokes every token in familyID, commits that even
+// though the request fails, and responds with 401.
+func rejectReusedRefreshToken(w http.ResponseWriter, r *http.Request, qtx *database.Queries, tx *sql.Tx, familyID uuid.UUID) {
+	if err := qtx.RevokeRefreshTokenFamily(r.Context(), familyID); err != nil {
+		msg := "Couldn't revoke refresh tokens"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		msg := "Couldn't revoke refresh tokens"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	msg := "refresh token was already used, log in again"
+	respondWithError(w, http.StatusUnauthorized, msg, nil)
+}
+
+func (apiCfg *apiConfig) handlerGetSessions(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := apiCfg.authenticateSession(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	dbSessions, err := apiCfg.dbQueries.GetActiveSessions(r.Context(), userID)
+	if err != nil {
+		msg := "could not get sessions"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	sessions := make([]Session, len(dbSessions))
+	for i, dbSession := range dbSessions {
+		sessions[i] = Session{
+			ID:         dbSession.FamilyID,
+			CreatedAt:  dbSession.CreatedAt,
+			LastUsedAt: dbSession.LastUsedAt,
+			ExpiresAt:  dbSession.ExpiresAt,
+			UserAgent:  dbSession.UserAgent,
+			IPAddress:  dbSession.IpAddress,
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, sessions)
+}
+
+func (apiCfg *apiConfig) handlerRevokeSession(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := apiCfg.authenticateSession(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		msg := "could not parse session id"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	// sessions of other users look the same as ones that don't exist
+	revoked, err := apiCfg.dbQueries.RevokeSession(r.Context(), database.RevokeSessionParams{
+		FamilyID: sessionID,
+		UserID:   userID,
+	})
+	if err != nil {
+		msg := "could not revoke session"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if revoked == 0 {
+		msg := "session does not exist"
+		respondWithError(w, http.StatusNotFound, msg, nil)
+		return
+	}
+
+	respondWithJSON(w, http.StatusNoContent, nil)
+}
+
+func (apiCfg *apiConfig) handlerRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := apiCfg.authenticateSession(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	if err := apiCfg.dbQueries.RevokeUserRefreshTokens(r.Context(), userID); err != nil {
+		msg := "could not revoke sessions"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusNoContent, nil)
+}
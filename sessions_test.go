@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestClientIP(t *testing.T) {
+	cases := []struct {
+		remoteAddr string
+		expected   string
+	}{
+		{remoteAddr: "203.0.113.7:52311", expected: "203.0.113.7"},
+		{remoteAddr: "[2001:db8::1]:443", expected: "2001:db8::1"},
+		{remoteAddr: "203.0.113.7", expected: "203.0.113.7"},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("POST", "/api/login", nil)
+		r.RemoteAddr = c.remoteAddr
+		r.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+		if got := clientIP(r); got != c.expected {
+			t.Errorf("clientIP(%q) = %q, expected %q", c.remoteAddr, got, c.expected)
+		}
+	}
+}
+
+func TestClientUserAgent(t *testing.T) {
+	r := httptest.NewRequest("POST", "/api/login", nil)
+	r.Header.Set("User-Agent", strings.Repeat("a", maxUserAgentLength+10))
+
+	if got := len(clientUserAgent(r)); got != maxUserAgentLength {
+		t.Errorf("len(clientUserAgent) = %d, expected %d", got, maxUserAgentLength)
+	}
+
+	// a two byte character straddling the limit is dropped whole
+	r.Header.Set("User-Agent", strings.Repeat("a", maxUserAgentLength-1)+"é")
+
+	if got := clientUserAgent(r); got != strings.Repeat("a", maxUserAgentLength-1) {
+		t.Errorf("clientUserAgent split a character, ending in %q", got[max(len(got)-3, 0):])
+	}
+
+	r.Header.Set("User-Agent", "curl/8.0 \xff\xfe")
+
+	if got := clientUserAgent(r); !utf8.ValidString(got) || got != "curl/8.0 \uFFFD" {
+		t.Errorf("clientUserAgent = %q, expected invalid bytes to be replaced", got)
+	}
+}
@@ -0,0 +1,32 @@
+-- name: LikeChirp :execrows
+INSERT INTO chirp_likes (user_id, chirp_id, created_at)
+VALUES (
+    $1,
+    $2,
+    NOW()
+)
+ON CONFLICT (user_id, chirp_id) DO NOTHING;
+
+-- name: UnlikeChirp :exec
+DELETE FROM chirp_likes
+WHERE user_id = $1 AND chirp_id = $2;
+
+-- name: GetLikeCounts :many
+SELECT chirp_id, COUNT(*) AS like_count FROM chirp_likes
+WHERE chirp_id = ANY(@ids::uuid[])
+GROUP BY chirp_id;
+
+-- name: GetLikedChirpIDs :many
+SELECT chirp_id FROM chirp_likes
+WHERE user_id = @user_id AND chirp_id = ANY(@ids::uuid[]);
+
+-- name: GetLikedChirpsByUser :many
+SELECT chirps.* FROM chirps
+JOIN chirp_likes ON chirp_likes.chirp_id = chirps.id
+WHERE chirp_likes.user_id = $1
+ORDER BY chirp_likes.created_at DESC;
+
+-- name: GetLikesByUser :many
+SELECT * FROM chirp_likes
+WHERE user_id = $1
+ORDER BY created_at ASC;
\ No newline at end of file
@@ -0,0 +1,15 @@
+-- name: AddChirpMention :exec
+INSERT INTO chirp_mentions (chirp_id, user_id)
+VALUES (
+    $1,
+    $2
+)
+ON CONFLICT (chirp_id, user_id) DO NOTHING;
+
+-- name: GetChirpMentions :many
+SELECT user_id FROM chirp_mentions
+WHERE chirp_id = $1;
+
+-- name: DeleteChirpMentions :exec
+DELETE FROM chirp_mentions
+WHERE chirp_id = $1;
@@ -1,27 +1,113 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to, kind, rechirp_of, quote_of)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
 )
 RETURNING *;
 
--- name: GetChirps :many
+-- name: ListChirpsAsc :many
 SELECT * FROM chirps
-ORDER BY created_at ASC;    
+WHERE (sqlc.narg(author_id)::uuid IS NULL OR user_id = sqlc.narg(author_id)::uuid)
+AND (
+    sqlc.narg(cursor_created_at)::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid)
+)
+ORDER BY created_at ASC, id ASC
+LIMIT @row_limit;
+
+-- name: ListChirpsDesc :many
+SELECT * FROM chirps
+WHERE (sqlc.narg(author_id)::uuid IS NULL OR user_id = sqlc.narg(author_id)::uuid)
+AND (
+    sqlc.narg(cursor_created_at)::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT @row_limit;
 
 -- name: GetChirp :one
 SELECT * FROM chirps
 WHERE id = $1;
 
+-- name: GetChirpForUpdate :one
+SELECT * FROM chirps
+WHERE id = $1
+FOR UPDATE;
+
 -- name: DeleteChrip :exec
 DELETE FROM chirps
 WHERE id = $1;
 
--- name: GetChripsByAuthor :many
+-- name: GetTimeline :many
+SELECT chirps.* FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = $1
+ORDER BY chirps.created_at DESC;
+
+-- name: GetReplyCounts :many
+SELECT in_reply_to, COUNT(*) AS reply_count FROM chirps
+WHERE in_reply_to = ANY(@ids::uuid[])
+GROUP BY in_reply_to;
+
+-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors(id, in_reply_to) AS (
+    SELECT c.id, c.in_reply_to FROM chirps c
+    WHERE c.id = $1
+    UNION ALL
+    SELECT parent.id, parent.in_reply_to FROM chirps parent
+    JOIN ancestors ON parent.id = ancestors.in_reply_to
+)
+SELECT chirps.* FROM chirps
+WHERE chirps.id IN (SELECT ancestors.id FROM ancestors) AND chirps.id <> $1
+ORDER BY chirps.created_at ASC;
+
+-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants(id) AS (
+    SELECT c.id FROM chirps c
+    WHERE c.in_reply_to = @id::uuid
+    UNION ALL
+    SELECT child.id FROM chirps child
+    JOIN descendants ON child.in_reply_to = descendants.id
+)
+SELECT chirps.* FROM chirps
+WHERE chirps.id IN (SELECT descendants.id FROM descendants)
+ORDER BY chirps.created_at ASC;
+
+-- name: GetChirpsByIDs :many
+SELECT * FROM chirps
+WHERE id = ANY(@ids::uuid[]);
+
+-- name: GetRechirp :one
+SELECT * FROM chirps
+WHERE user_id = @user_id AND rechirp_of = @rechirp_of::uuid;
+
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: SearchChirps :many
+SELECT chirps.*,
+    ts_rank(to_tsvector('english', chirps.body), tsq) AS rank,
+    ts_headline('english', chirps.body, tsq, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2') AS snippet
+FROM chirps, websearch_to_tsquery('english', @query::text) tsq
+WHERE to_tsvector('english', chirps.body) @@ tsq
+AND (sqlc.narg(author_id)::uuid IS NULL OR chirps.user_id = sqlc.narg(author_id)::uuid)
+AND (sqlc.narg(since)::timestamp IS NULL OR chirps.created_at >= sqlc.narg(since)::timestamp)
+AND (sqlc.narg(until)::timestamp IS NULL OR chirps.created_at < sqlc.narg(until)::timestamp)
+ORDER BY rank DESC, chirps.created_at DESC
+LIMIT @row_limit;
+
+-- name: GetChirpsByAuthor :many
 SELECT * FROM chirps
-where user_id = $1
+WHERE user_id = $1
 ORDER BY created_at ASC;
\ No newline at end of file
@@ -0,0 +1,45 @@
+-- name: UpsertHashtag :one
+INSERT INTO hashtags (id, created_at, name)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1
+)
+ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+RETURNING *;
+
+-- name: AddChirpHashtag :exec
+INSERT INTO chirp_hashtags (chirp_id, hashtag_id, created_at)
+VALUES (
+    $1,
+    $2,
+    $3
+)
+ON CONFLICT (chirp_id, hashtag_id) DO NOTHING;
+
+-- name: DeleteChirpHashtags :exec
+DELETE FROM chirp_hashtags
+WHERE chirp_id = $1;
+
+-- name: GetChirpsByHashtag :many
+SELECT chirps.* FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+WHERE hashtags.name = @name
+ORDER BY chirps.created_at DESC
+LIMIT @row_limit;
+
+-- name: GetTrendingHashtags :many
+SELECT hashtags.name,
+    COUNT(*) FILTER (WHERE chirp_hashtags.created_at >= @since) AS uses,
+    COUNT(*) FILTER (WHERE chirp_hashtags.created_at < @since) AS previous_uses,
+    MAX(chirp_hashtags.created_at)::timestamp AS last_used_at
+FROM chirp_hashtags
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+WHERE chirp_hashtags.created_at >= @previous_since
+GROUP BY hashtags.name
+HAVING COUNT(*) FILTER (WHERE chirp_hashtags.created_at >= @since) > 0
+ORDER BY COUNT(*) FILTER (WHERE chirp_hashtags.created_at >= @since)
+    - COUNT(*) FILTER (WHERE chirp_hashtags.created_at < @since) DESC,
+    uses DESC, last_used_at DESC
+LIMIT @row_limit;
\ No newline at end of file
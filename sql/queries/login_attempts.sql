@@ -0,0 +1,45 @@
+-- name: ReserveLoginAttempt :one
+INSERT INTO login_attempts (attempt_key, pending, reserved_at)
+VALUES (@attempt_key, 1, @reserved_at)
+ON CONFLICT (attempt_key) DO UPDATE
+SET failures = CASE
+        WHEN login_attempts.last_failure_at < @window_start THEN 0
+        ELSE login_attempts.failures
+    END,
+    pending = CASE
+        WHEN login_attempts.reserved_at < @stale_before THEN 1
+        ELSE login_attempts.pending + 1
+    END,
+    reserved_at = @reserved_at
+RETURNING *;
+
+-- name: ReleaseLoginAttempt :exec
+UPDATE login_attempts
+SET pending = GREATEST(pending - 1, 0)
+WHERE attempt_key = $1;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_attempts (attempt_key, failures, last_failure_at)
+VALUES (@attempt_key, 1, @failed_at)
+ON CONFLICT (attempt_key) DO UPDATE
+SET failures = CASE
+        WHEN login_attempts.last_failure_at < @window_start THEN 1
+        ELSE login_attempts.failures + 1
+    END,
+    last_failure_at = @failed_at
+RETURNING failures;
+
+-- name: BlockLoginAttempts :exec
+UPDATE login_attempts
+SET blocked_until = GREATEST(blocked_until, $2)
+WHERE attempt_key = $1;
+
+-- name: DeleteLoginAttempts :exec
+DELETE FROM login_attempts
+WHERE attempt_key = $1;
+
+-- name: DeleteExpiredLoginAttempts :exec
+DELETE FROM login_attempts
+WHERE (last_failure_at IS NULL OR last_failure_at < @window_start)
+    AND (blocked_until IS NULL OR blocked_until < @now)
+    AND (pending = 0 OR reserved_at < @stale_before);
@@ -0,0 +1,28 @@
+-- name: CreateNotification :exec
+INSERT INTO notifications (id, created_at, user_id, actor_id, kind, chirp_id, read_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NULL
+)
+ON CONFLICT (user_id, actor_id, kind, chirp_id) DO NOTHING;
+
+-- name: GetNotifications :many
+SELECT * FROM notifications
+WHERE user_id = @user_id AND (NOT @unread_only::boolean OR read_at IS NULL)
+ORDER BY created_at DESC
+LIMIT @row_limit;
+
+-- name: MarkNotificationsRead :exec
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = @user_id AND read_at IS NULL AND id = ANY(@ids::uuid[]);
+
+-- name: MarkAllNotificationsRead :exec
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = $1 AND read_at IS NULL;
@@ -0,0 +1,96 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, created_at, user_id, name, secret_hash, redirect_uris, scopes)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    @user_id,
+    @name,
+    @secret_hash,
+    @redirect_uris::text[],
+    @scopes::text[]
+)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE id = $1;
+
+-- name: GetOAuthClients :many
+SELECT * FROM oauth_clients
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1 AND user_id = $2;
+
+-- name: CreateOAuthAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (code_hash, created_at, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at)
+VALUES (
+    @code_hash,
+    NOW(),
+    @client_id,
+    @user_id,
+    @redirect_uri,
+    @scopes::text[],
+    @code_challenge,
+    @expires_at
+);
+
+-- name: UseOAuthAuthorizationCode :one
+UPDATE oauth_authorization_codes
+SET used_at = NOW()
+WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: CreateOAuthGrant :one
+INSERT INTO oauth_grants (id, created_at, client_id, user_id, scopes, code_hash, refresh_token_hash, refresh_expires_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    @client_id,
+    @user_id,
+    @scopes::text[],
+    @code_hash,
+    @refresh_token_hash,
+    @refresh_expires_at
+)
+RETURNING *;
+
+-- name: GetOAuthGrant :one
+SELECT * FROM oauth_grants
+WHERE id = $1 AND revoked_at IS NULL;
+
+-- name: GetOAuthGrantByRefreshToken :one
+SELECT * FROM oauth_grants
+WHERE refresh_token_hash = $1
+    AND revoked_at IS NULL
+    AND refresh_expires_at > NOW();
+
+-- name: RotateOAuthRefreshToken :execrows
+UPDATE oauth_grants
+SET refresh_token_hash = @new_hash, refresh_expires_at = @refresh_expires_at
+WHERE id = @id AND refresh_token_hash = @old_hash AND revoked_at IS NULL;
+
+-- name: RetireOAuthRefreshToken :exec
+INSERT INTO oauth_retired_refresh_tokens (token_hash, grant_id, retired_at)
+VALUES ($1, $2, NOW());
+
+-- name: GetRetiredOAuthRefreshToken :one
+SELECT * FROM oauth_retired_refresh_tokens
+WHERE token_hash = $1;
+
+-- name: RevokeOAuthGrant :exec
+UPDATE oauth_grants
+SET revoked_at = NOW()
+WHERE id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeOAuthGrantsByCode :exec
+UPDATE oauth_grants
+SET revoked_at = NOW()
+WHERE code_hash = $1 AND revoked_at IS NULL;
+
+-- name: RevokeUserOAuthGrants :exec
+UPDATE oauth_grants
+SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD column in_reply_to uuid REFERENCES chirps(id) ON DELETE SET NULL;
+
+CREATE INDEX chirps_in_reply_to_idx ON chirps(in_reply_to);
+
+-- +goose Down
+ALTER TABLE chirps
+DROP column in_reply_to;
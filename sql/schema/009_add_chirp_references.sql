@@ -0,0 +1,14 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD column kind TEXT NOT NULL DEFAULT 'chirp' CHECK (kind IN ('chirp', 'rechirp', 'quote')),
+ADD column rechirp_of uuid REFERENCES chirps(id) ON DELETE CASCADE,
+ADD column quote_of uuid REFERENCES chirps(id) ON DELETE SET NULL;
+
+CREATE UNIQUE INDEX chirps_user_id_rechirp_of_idx ON chirps(user_id, rechirp_of)
+WHERE rechirp_of IS NOT NULL;
+
+-- +goose Down
+ALTER TABLE chirps
+DROP column quote_of,
+DROP column rechirp_of,
+DROP column kind;
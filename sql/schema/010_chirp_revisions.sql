@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE chirp_revisions(
+    id uuid PRIMARY KEY,
+    created_at timestamp NOT NULL,
+    chirp_id uuid NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    body text NOT NULL
+);
+
+CREATE INDEX chirp_revisions_chirp_id_idx ON chirp_revisions(chirp_id);
+
+-- +goose Down
+DROP TABLE chirp_revisions;
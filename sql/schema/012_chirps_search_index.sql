@@ -0,0 +1,7 @@
+-- +goose Up
+-- an expression index rather than a stored column, so chirp rows don't
+-- carry the tsvector around
+CREATE INDEX chirps_body_search_idx ON chirps USING GIN (to_tsvector('english', body));
+
+-- +goose Down
+DROP INDEX chirps_body_search_idx;
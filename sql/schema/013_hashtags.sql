@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE hashtags(
+    id uuid PRIMARY KEY,
+    created_at timestamp NOT NULL,
+    name text NOT NULL UNIQUE
+);
+
+CREATE TABLE chirp_hashtags(
+    chirp_id uuid NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    hashtag_id uuid NOT NULL REFERENCES hashtags(id) ON DELETE CASCADE,
+    created_at timestamp NOT NULL,
+    PRIMARY KEY (chirp_id, hashtag_id)
+);
+
+CREATE INDEX chirp_hashtags_hashtag_id_idx ON chirp_hashtags(hashtag_id);
+CREATE INDEX chirp_hashtags_created_at_idx ON chirp_hashtags(created_at);
+
+-- +goose Down
+DROP TABLE chirp_hashtags;
+DROP TABLE hashtags;
@@ -0,0 +1,32 @@
+-- +goose Up
+ALTER TABLE users
+ADD column handle TEXT;
+
+CREATE UNIQUE INDEX users_handle_lower_idx ON users(lower(handle));
+
+CREATE TABLE chirp_mentions(
+    chirp_id uuid NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (chirp_id, user_id)
+);
+
+CREATE TABLE notifications(
+    id uuid PRIMARY KEY,
+    created_at timestamp NOT NULL,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    actor_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('mention', 'reply', 'like')),
+    chirp_id uuid NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    read_at timestamp
+);
+
+CREATE INDEX notifications_user_id_created_at_idx ON notifications(user_id, created_at);
+
+CREATE UNIQUE INDEX notifications_event_idx ON notifications(user_id, actor_id, kind, chirp_id);
+
+-- +goose Down
+DROP TABLE notifications;
+DROP TABLE chirp_mentions;
+
+ALTER TABLE users
+DROP column handle;
@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE users
+ADD column display_name TEXT NOT NULL DEFAULT '',
+ADD column bio TEXT NOT NULL DEFAULT '',
+ADD column location TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE users
+DROP column location,
+DROP column bio,
+DROP column display_name;
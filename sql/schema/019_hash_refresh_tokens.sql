@@ -0,0 +1,16 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+RENAME column token TO token_hash;
+
+-- re-key existing rows with the same digest auth.HashToken produces, so
+-- sessions that were already handed out keep working
+UPDATE refresh_tokens
+SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex'),
+    replaced_by = encode(sha256(convert_to(replaced_by, 'UTF8')), 'hex');
+
+-- +goose Down
+-- digests can't be turned back into tokens, so every session is dropped
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+RENAME column token_hash TO token;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+ADD column user_agent TEXT NOT NULL DEFAULT '',
+ADD column ip_address TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP column ip_address,
+DROP column user_agent;
@@ -0,0 +1,22 @@
+-- +goose Up
+ALTER TABLE users
+ADD column totp_secret TEXT,
+ADD column totp_enabled_at TIMESTAMP,
+ADD column totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE totp_recovery_codes (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMP,
+    UNIQUE (user_id, code_hash)
+);
+
+-- +goose Down
+DROP TABLE totp_recovery_codes;
+
+ALTER TABLE users
+DROP column totp_last_step,
+DROP column totp_enabled_at,
+DROP column totp_secret;
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE login_attempts (
+    attempt_key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP,
+    blocked_until TIMESTAMP,
+    -- attempts let through but not yet known to have failed or succeeded
+    pending INTEGER NOT NULL DEFAULT 0,
+    reserved_at TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE login_attempts;
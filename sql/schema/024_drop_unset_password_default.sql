@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE users
+ALTER COLUMN hashed_password DROP DEFAULT;
+
+-- +goose Down
+ALTER TABLE users
+ALTER COLUMN hashed_password SET DEFAULT 'unset';
@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE users
+ALTER COLUMN hashed_password DROP NOT NULL;
+
+-- users without a password have no hash, instead of a placeholder one
+UPDATE users SET hashed_password = NULL WHERE hashed_password = 'unset';
+
+-- +goose Down
+UPDATE users SET hashed_password = 'unset' WHERE hashed_password IS NULL;
+
+ALTER TABLE users
+ALTER COLUMN hashed_password SET NOT NULL;
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type ThreadNode struct {
+	Chirp
+	Replies []ThreadNode `json:"replies"`
+}
+
+type Thread struct {
+	Ancestors []Chirp    `json:"ancestors"`
+	Chirp     ThreadNode `json:"chirp"`
+}
+
+// buildThread nests descendants under root by following their in_reply_to
+// links. Replies keep the order they have in descendants.
+func buildThread(root Chirp, descendants []Chirp) ThreadNode {
+	children := make(map[uuid.UUID][]Chirp)
+	for _, chirp := range descendants {
+		if chirp.InReplyTo.Valid {
+			children[chirp.InReplyTo.UUID] = append(children[chirp.InReplyTo.UUID], chirp)
+		}
+	}
+
+	return buildThreadNode(root, children)
+}
+
+func buildThreadNode(chirp Chirp, children map[uuid.UUID][]Chirp) ThreadNode {
+	node := ThreadNode{
+		Chirp:   chirp,
+		Replies: make([]ThreadNode, len(children[chirp.ID])),
+	}
+	for i, child := range children[chirp.ID] {
+		node.Replies[i] = buildThreadNode(child, children)
+	}
+	return node
+}
+
+func (apiCfg *apiConfig) handlerGetThread(w http.ResponseWriter, r *http.Request) {
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		msg := "could not parse chirpID from string to uuid"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	dbChirp, err := apiCfg.dbQueries.GetChirp(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := "chirp does not exist"
+		respondWithError(w, http.StatusNotFound, msg, err)
+		return
+	}
+
+	if err != nil {
+		msg := "db error getting chrip"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	dbAncestors, err := apiCfg.dbQueries.GetChirpAncestors(r.Context(), chirpID)
+	if err != nil {
+		msg := "could not get chirp ancestors"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	dbDescendants, err := apiCfg.dbQueries.GetChirpDescendants(r.Context(), chirpID)
+	if err != nil {
+		msg := "could not get chirp replies"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	chirps := mapChirp(dbAncestors)
+	chirps = append(chirps, convertChirp(dbChirp))
+	chirps = append(chirps, mapChirp(dbDescendants)...)
+
+	if err := apiCfg.populateChirps(r.Context(), chirps, apiCfg.viewerID(r)); err != nil {
+		msg := "could not get chirp details"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	rootIndex := len(dbAncestors)
+
+	thread := Thread{
+		Ancestors: chirps[:rootIndex],
+		Chirp:     buildThread(chirps[rootIndex], chirps[rootIndex+1:]),
+	}
+
+	respondWithJSON(w, http.StatusOK, thread)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBuildThread(t *testing.T) {
+	root := Chirp{ID: uuid.New(), Body: "root"}
+	reply1 := Chirp{ID: uuid.New(), Body: "reply 1", InReplyTo: uuid.NullUUID{UUID: root.ID, Valid: true}}
+	reply2 := Chirp{ID: uuid.New(), Body: "reply 2", InReplyTo: uuid.NullUUID{UUID: root.ID, Valid: true}}
+	nested := Chirp{ID: uuid.New(), Body: "nested", InReplyTo: uuid.NullUUID{UUID: reply1.ID, Valid: true}}
+
+	actual := buildThread(root, []Chirp{reply1, reply2, nested})
+
+	if actual.Chirp != root {
+		t.Fatalf("actual.Chirp == %v, expected: %v", actual.Chirp, root)
+	}
+
+	if len(actual.Replies) != 2 {
+		t.Fatalf("len(actual.Replies) == %d, expected: 2", len(actual.Replies))
+	}
+
+	if actual.Replies[0].Chirp != reply1 || actual.Replies[1].Chirp != reply2 {
+		t.Errorf("actual.Replies == %v, expected replies in order: %v, %v", actual.Replies, reply1, reply2)
+	}
+
+	if len(actual.Replies[0].Replies) != 1 || actual.Replies[0].Replies[0].Chirp != nested {
+		t.Errorf("actual.Replies[0].Replies == %v, expected: [%v]", actual.Replies[0].Replies, nested)
+	}
+
+	if len(actual.Replies[1].Replies) != 0 {
+		t.Errorf("len(actual.Replies[1].Replies) == %d, expected: 0", len(actual.Replies[1].Replies))
+	}
+}
+
+func TestBuildThread_NoReplies(t *testing.T) {
+	root := Chirp{ID: uuid.New(), Body: "root"}
+
+	actual := buildThread(root, nil)
+
+	if actual.Replies == nil || len(actual.Replies) != 0 {
+		t.Errorf("actual.Replies == %v, expected empty non-nil slice", actual.Replies)
+	}
+}
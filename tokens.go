@@ -0,0 +1,213 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/7minutech/chirpy/internal/auth"
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxTokenNameLength   = 50
+	maxTokenLifetimeDays = 365
+	maxTokensPerUser     = 50
+)
+
+// PersonalAccessToken lets bots act for a user without their password. Token
+// is only set in the response that creates it.
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+func convertPersonalAccessToken(dbToken database.PersonalAccessToken) PersonalAccessToken {
+	token := PersonalAccessToken{
+		ID:        dbToken.ID,
+		CreatedAt: dbToken.CreatedAt,
+		Name:      dbToken.Name,
+		Scopes:    dbToken.Scopes,
+	}
+	if dbToken.LastUsedAt.Valid {
+		token.LastUsedAt = &dbToken.LastUsedAt.Time
+	}
+	if dbToken.ExpiresAt.Valid {
+		token.ExpiresAt = &dbToken.ExpiresAt.Time
+	}
+	return token
+}
+
+// validateScopes checks every scope is known and returns them sorted without
+// duplicates.
+func validateScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+
+	for _, scope := range scopes {
+		if !slices.Contains(allScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q, must be one of %s", scope, strings.Join(allScopes, ", "))
+		}
+	}
+
+	scopes = slices.Clone(scopes)
+	slices.Sort(scopes)
+
+	return slices.Compact(scopes), nil
+}
+
+func (apiCfg *apiConfig) handlerCreateToken(w http.ResponseWriter, r *http.Request) {
+
+	defer r.Body.Close()
+
+	userID, err := apiCfg.authenticateSession(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	type parameters struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		msg := "could not decode request body"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	if params.Name == "" || utf8.RuneCountInString(params.Name) > maxTokenNameLength {
+		msg := fmt.Sprintf("name must be 1 to %d characters", maxTokenNameLength)
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	if params.ExpiresInDays < 0 || params.ExpiresInDays > maxTokenLifetimeDays {
+		msg := fmt.Sprintf("expires_in_days must be between 0 and %d", maxTokenLifetimeDays)
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	scopes, err := validateScopes(params.Scopes)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	existing, err := apiCfg.dbQueries.GetPersonalAccessTokens(r.Context(), userID)
+	if err != nil {
+		msg := "could not get tokens"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if len(existing) >= maxTokensPerUser {
+		msg := fmt.Sprintf("users can have at most %d tokens", maxTokensPerUser)
+		respondWithError(w, http.StatusConflict, msg, nil)
+		return
+	}
+
+	tok, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		msg := "could not create token"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	// zero days means the token never expires
+	var expiresAt sql.NullTime
+	if params.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().UTC().AddDate(0, 0, params.ExpiresInDays), Valid: true}
+	}
+
+	dbToken, err := apiCfg.dbQueries.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    userID,
+		Name:      params.Name,
+		TokenHash: auth.HashToken(tok),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		msg := "could not create token"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	resp := convertPersonalAccessToken(dbToken)
+	resp.Token = tok
+
+	respondWithJSON(w, http.StatusCreated, resp)
+}
+
+func (apiCfg *apiConfig) handlerGetTokens(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := apiCfg.authenticateSession(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	dbTokens, err := apiCfg.dbQueries.GetPersonalAccessTokens(r.Context(), userID)
+	if err != nil {
+		msg := "could not get tokens"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	tokens := make([]PersonalAccessToken, len(dbTokens))
+	for i, dbToken := range dbTokens {
+		tokens[i] = convertPersonalAccessToken(dbToken)
+	}
+
+	respondWithJSON(w, http.StatusOK, tokens)
+}
+
+func (apiCfg *apiConfig) handlerRevokeToken(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := apiCfg.authenticateSession(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	tokenID, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		msg := "could not parse token id"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	revoked, err := apiCfg.dbQueries.RevokePersonalAccessToken(r.Context(), database.RevokePersonalAccessTokenParams{
+		ID:     tokenID,
+		UserID: userID,
+	})
+	if err != nil {
+		msg := "could not revoke token"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if revoked == 0 {
+		msg := "token does not exist"
+		respondWithError(w, http.StatusNotFound, msg, nil)
+		return
+	}
+
+	respondWithJSON(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestValidateScopes(t *testing.T) {
+	cases := []struct {
+		input    []string
+		expected []string
+		wantErr  bool
+	}{
+		{
+			input:    []string{scopeChirpsWrite, scopeChirpsRead},
+			expected: []string{scopeChirpsRead, scopeChirpsWrite},
+		},
+		{
+			input:    []string{scopeProfileWrite, scopeProfileWrite},
+			expected: []string{scopeProfileWrite},
+		},
+		{
+			input:   []string{},
+			wantErr: true,
+		},
+		{
+			input:   []string{scopeChirpsRead, "admin"},
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		got, err := validateScopes(c.input)
+		if (err != nil) != c.wantErr {
+			t.Errorf("validateScopes(%v) err = %v, wantErr %v", c.input, err, c.wantErr)
+			continue
+		}
+		if !slices.Equal(got, c.expected) {
+			t.Errorf("validateScopes(%v) = %v, expected %v", c.input, got, c.expected)
+		}
+	}
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/7minutech/chirpy/internal/auth"
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	totpIssuer        = "Chirpy"
+	recoveryCodeCount = 10
+	// mfaTokenTTL is how long a user has to enter their code after the
+	// password step of logging in
+	mfaTokenTTL = 5 * time.Minute
+)
+
+// createRecoveryCodes replaces userID's recovery codes with a new set. Only
+// their hashes are stored, so this is the one time they can be shown.
+func createRecoveryCodes(ctx context.Context, queries *database.Queries, userID uuid.UUID) ([]string, error) {
+	if err := queries.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := auth.MakeRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		err = queries.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(code)),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		codes[i] = code
+	}
+
+	return codes, nil
+}
+
+// checkSecondFactor accepts either a TOTP code or a recovery code. Both can
+// only be used once: a TOTP code is refused if its time step, or a later
+// one, was already used.
+func (apiCfg *apiConfig) checkSecondFactor(ctx context.Context, user database.User, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := auth.ValidateTOTP(user.TotpSecret.String, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+
+		used, err := apiCfg.dbQueries.UseUserTOTPStep(ctx, database.UseUserTOTPStepParams{
+			TotpLastStep: step,
+			ID:           user.ID,
+		})
+		return used == 1, err
+	}
+
+	if recoveryCode != "" {
+		used, err := apiCfg.dbQueries.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			UserID:   user.ID,
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode)),
+		})
+		return used == 1, err
+	}
+
+	return false, nil
+}
+
+func (apiCfg *apiConfig) handlerEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := apiCfg.authenticateSession(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	user, err := apiCfg.dbQueries.GetUser(r.Context(), userID)
+	if err != nil {
+		msg := "could not get user"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		msg := "two-factor authentication is already enabled"
+		respondWithError(w, http.StatusConflict, msg, nil)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		msg := "could not create secret"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	// the secret isn't used for logging in until it's confirmed with a code,
+	// so enrolling again just replaces it
+	_, err = apiCfg.dbQueries.SetUserTOTPSecret(r.Context(), database.SetUserTOTPSecretParams{
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+		ID:         user.ID,
+	})
+	if err != nil {
+		msg := "could not save secret"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	type response struct {
+		Secret     string `json:"secret"`
+		OtpauthURI string `json:"otpauth_uri"`
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Secret:     secret,
+		OtpauthURI: auth.TOTPURI(secret, totpIssuer, user.Email),
+	})
+}
+
+func (apiCfg *apiConfig) handlerConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+
+	defer r.Body.Close()
+
+	userID, err := apiCfg.authenticateSession(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	type parameters struct {
+		Code string `json:"code"`
+	}
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		msg := "could not decode request body"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	user, err := apiCfg.dbQueries.GetUser(r.Context(), userID)
+	if err != nil {
+		msg := "could not get user"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		msg := "two-factor authentication is already enabled"
+		respondWithError(w, http.StatusConflict, msg, nil)
+		return
+	}
+
+	if !user.TotpSecret.Valid {
+		msg := "two-factor enrollment has not been started"
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(user.TotpSecret.String, params.Code, time.Now())
+	if !ok {
+		msg := "code is not valid"
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		msg := "could not start transaction"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := apiCfg.dbQueries.WithTx(tx)
+
+	_, err = qtx.EnableUserTOTP(r.Context(), database.EnableUserTOTPParams{
+		TotpLastStep: step,
+		ID:           user.ID,
+	})
+	if err != nil {
+		msg := "could not enable two-factor authentication"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	codes, err := createRecoveryCodes(r.Context(), qtx, user.ID)
+	if err != nil {
+		msg := "could not create recovery codes"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		msg := "could not enable two-factor authentication"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	respondWithJSON(w, http.StatusOK, response{RecoveryCodes: codes})
+}
+
+func (apiCfg *apiConfig) handlerRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+
+	defer r.Body.Close()
+
+	userID, err := apiCfg.authenticateSession(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	type parameters struct {
+		Code string `json:"code"`
+	}
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		msg := "could not decode request body"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	user, err := apiCfg.dbQueries.GetUser(r.Context(), userID)
+	if err != nil {
+		msg := "could not get user"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if !user.TotpEnabledAt.Valid {
+		msg := "two-factor authentication is not enabled"
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	// a stolen session must not be a way around the login limits on guessing
+	// the code
+	if !apiCfg.checkLoginThrottle(w, r, user.Email) {
+		return
+	}
+	defer apiCfg.releaseLoginThrottle(r, user.Email)
+
+	ok, err := apiCfg.checkSecondFactor(r.Context(), user, params.Code, "")
+	if err != nil {
+		msg := "could not check code"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if !ok {
+		msg := "code is not valid"
+		apiCfg.failReauth(w, r, user.Email, msg, nil)
+		return
+	}
+
+	tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		msg := "could not start transaction"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := apiCfg.dbQueries.WithTx(tx)
+
+	codes, err := createRecoveryCodes(r.Context(), qtx, user.ID)
+	if err != nil {
+		msg := "could not create recovery codes"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		msg := "could not create recovery codes"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	respondWithJSON(w, http.StatusOK, response{RecoveryCodes: codes})
+}
+
+func (apiCfg *apiConfig) handlerDisableTOTP(w http.ResponseWriter, r *http.Request) {
+
+	defer r.Body.Close()
+
+	userID, err := apiCfg.authenticateSession(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	type parameters struct {
+		Password string `json:"password"`
+	}
+
+	var params parameters
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		msg := "could not decode request body"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	user, err := apiCfg.dbQueries.GetUser(r.Context(), userID)
+	if err != nil {
+		msg := "could not get user"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if !checkHasPassword(w, user) {
+		return
+	}
+
+	// a stolen session must not be a way around the login limits on guessing
+	// the password
+	if !apiCfg.checkLoginThrottle(w, r, user.Email) {
+		return
+	}
+	defer apiCfg.releaseLoginThrottle(r, user.Email)
+
+	ok, err := auth.CheckPasswordHash(params.Password, user.HashedPassword.String)
+	if !ok || err != nil {
+		msg := "password is incorrect"
+		apiCfg.failReauth(w, r, user.Email, msg, err)
+		return
+	}
+
+	tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		msg := "could not start transaction"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := apiCfg.dbQueries.WithTx(tx)
+
+	if _, err := qtx.DisableUserTOTP(r.Context(), user.ID); err != nil {
+		msg := "could not disable two-factor authentication"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if err := qtx.DeleteRecoveryCodes(r.Context(), user.ID); err != nil {
+		msg := "could not disable two-factor authentication"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		msg := "could not disable two-factor authentication"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusNoContent, nil)
+}
+
+func (apiCfg *apiConfig) handlerLoginMFA(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	var params parameters
+
+	defer r.Body.Close()
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		msg := "could not decode request body"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	userID, err := auth.ValidateMFAToken(params.MFAToken, apiCfg.jwtKeys)
+	if err != nil {
+		msg := "mfa token is not valid, log in again"
+		respondWithError(w, http.StatusUnauthorized, msg, err)
+		return
+	}
+
+	user, err := apiCfg.dbQueries.GetUser(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := "mfa token is not valid, log in again"
+		respondWithError(w, http.StatusUnauthorized, msg, err)
+		return
+	}
+
+	if err != nil {
+		msg := "could not get user"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	// two-factor authentication was turned off since the mfa token was issued
+	if !user.TotpEnabledAt.Valid {
+		msg := "mfa token is not valid, log in again"
+		respondWithError(w, http.StatusUnauthorized, msg, nil)
+		return
+	}
+
+	// wrong codes count against the account like wrong passwords, so the
+	// six digits can't be guessed within one mfa token's lifetime
+	if !apiCfg.checkLoginThrottle(w, r, user.Email) {
+		return
+	}
+	defer apiCfg.releaseLoginThrottle(r, user.Email)
+
+	ok, err := apiCfg.checkSecondFactor(r.Context(), user, params.Code, params.RecoveryCode)
+	if err != nil {
+		msg := "could not check code"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if !ok {
+		msg := "code is not valid"
+		apiCfg.failLogin(w, r, user.Email, msg, nil)
+		return
+	}
+
+	apiCfg.completeLogin(w, r, user)
+}
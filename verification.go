@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"time"
+
+	"github.com/7minutech/chirpy/internal/auth"
+	"github.com/7minutech/chirpy/internal/database"
+	"github.com/7minutech/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const verificationTokenTTL = 24 * time.Hour
+
+// validEmail accepts a bare address like "user@example.com". Display names
+// ("User <user@example.com>") are rejected so the stored value is always
+// something we can send to.
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+// createVerificationToken replaces any unused verification tokens for userID
+// with a fresh one. Only the token's hash is stored.
+func createVerificationToken(ctx context.Context, queries *database.Queries, userID uuid.UUID) (string, error) {
+	if err := queries.DeleteUserEmailVerificationTokens(ctx, userID); err != nil {
+		return "", err
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = queries.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		ExpiresAt: time.Now().UTC().Add(verificationTokenTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// sendVerificationEmail is best effort: the account already exists, and the
+// user can ask for another email if this one never arrives.
+func (apiCfg *apiConfig) sendVerificationEmail(ctx context.Context, email, token string) {
+	msg := mailer.Message{
+		To:      email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf("Confirm your email address by sending this token to POST /api/users/verify:\n\n"+
+			"%s\n\nThe token expires in %d hours.\n", token, int(verificationTokenTTL.Hours())),
+	}
+
+	if err := apiCfg.mailer.Send(ctx, msg); err != nil {
+		log.Printf("Error sending verification email: %s", err)
+	}
+}
+
+func (apiCfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	var params parameters
+
+	defer r.Body.Close()
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		msg := "could not decode request body"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		msg := "could not start transaction"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := apiCfg.dbQueries.WithTx(tx)
+
+	// marking the token used and checking it in one statement keeps it single
+	// use even when two requests race
+	verification, err := qtx.UseEmailVerificationToken(r.Context(), auth.HashToken(params.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := "verification token is invalid or expired"
+		respondWithError(w, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	if err != nil {
+		msg := "could not verify email"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	user, err := qtx.VerifyUserEmail(r.Context(), verification.UserID)
+	if err != nil {
+		msg := "could not verify email"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		msg := "could not verify email"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, convertUser(user))
+}
+
+func (apiCfg *apiConfig) handlerResendVerification(w http.ResponseWriter, r *http.Request) {
+
+	defer r.Body.Close()
+
+	userID, err := apiCfg.authenticateSession(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	user, err := apiCfg.dbQueries.GetUser(r.Context(), userID)
+	if err != nil {
+		msg := "could not get user"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	if user.EmailVerifiedAt.Valid {
+		msg := "email is already verified"
+		respondWithError(w, http.StatusConflict, msg, nil)
+		return
+	}
+
+	token, err := createVerificationToken(r.Context(), apiCfg.dbQueries, user.ID)
+	if err != nil {
+		msg := "could not create verification token"
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	apiCfg.sendVerificationEmail(r.Context(), user.Email, token)
+
+	respondWithJSON(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestValidEmail(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected bool
+	}{
+		{input: "user@example.com", expected: true},
+		{input: "first.last+tag@sub.example.org", expected: true},
+		{input: "", expected: false},
+		{input: "not-an-email", expected: false},
+		{input: "user@", expected: false},
+		{input: "User <user@example.com>", expected: false},
+		{input: " user@example.com", expected: false},
+	}
+
+	for _, c := range cases {
+		if got := validEmail(c.input); got != c.expected {
+			t.Errorf("validEmail(%q) = %v, expected %v", c.input, got, c.expected)
+		}
+	}
+}